@@ -1,12 +1,179 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"hygoal/internal/auth"
+	"hygoal/internal/config"
+	"hygoal/internal/logging"
+	"hygoal/internal/metrics"
 	"hygoal/internal/network"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
 )
 
+var CLI struct {
+	Config kong.ConfigFlag `help:"Config file to load on top of data/hygoal.yaml and data/hygoal.<ENV>.yaml." short:"c" placeholder:"FILE" env:"HYGOAL_CONFIG"`
+
+	Serve ServeCmd `cmd:"" default:"withargs" help:"Run the Hygoal server."`
+}
+
+type ServeCmd struct {
+	Bind []string `help:"Addresses to listen on, all interfaces when empty." placeholder:"ADDR" env:"HYGOAL_BIND"`
+	Port int      `help:"UDP port to listen on." default:"5520" env:"HYGOAL_PORT"`
+	IPv6 bool     `name:"ipv6" help:"Allow IPv6, binding the dual-stack wildcard when no address is given." env:"HYGOAL_IPV6"`
+	ALPN []string `name:"alpn" help:"ALPN protocols to accept." default:"hytale/1" env:"HYGOAL_ALPN"`
+
+	IdleTimeout        time.Duration `help:"Close connections idle for this long." default:"30s" env:"HYGOAL_IDLE_TIMEOUT"`
+	HandshakeTimeout   time.Duration `help:"Give up on handshakes idle for this long." default:"10s" env:"HYGOAL_HANDSHAKE_TIMEOUT"`
+	MaxIncomingStreams int64         `help:"Streams a client may open concurrently." default:"100" env:"HYGOAL_MAX_INCOMING_STREAMS"`
+	MaxFrameSize       int           `help:"Largest frame payload accepted or sent, in bytes." default:"1048576" env:"HYGOAL_MAX_FRAME_SIZE"`
+	SendQueueSize      int           `help:"Outbound packets buffered per stream before senders wait." default:"256" env:"HYGOAL_SEND_QUEUE_SIZE"`
+
+	ConnectionsPerIP   int           `name:"connections-per-ip" help:"Connections one IP address may open per --connection-window, 0 for no limit." default:"20" env:"HYGOAL_CONNECTIONS_PER_IP"`
+	ConnectionWindow   time.Duration `help:"Window --connections-per-ip counts connections in." default:"1m" env:"HYGOAL_CONNECTION_WINDOW"`
+	MaxUnauthenticated int           `help:"Connections allowed to be handshaking or logging in at once, 0 for no limit." default:"512" env:"HYGOAL_MAX_UNAUTHENTICATED"`
+	RetryThreshold     int           `help:"Unauthenticated connections from which new clients must validate their address with a QUIC Retry, 0 to never ask." default:"64" env:"HYGOAL_RETRY_THRESHOLD"`
+	MaxStreams         int           `help:"Streams a client may open over a connection, 0 for no limit." default:"16" env:"HYGOAL_MAX_STREAMS"`
+
+	PingInterval   time.Duration `help:"How often players are pinged to measure their round trip, 0 to never ping." default:"5s" env:"HYGOAL_PING_INTERVAL"`
+	MaxMissedPongs int           `help:"Pings in a row a player may leave unanswered before being kicked, 0 to never kick." default:"3" env:"HYGOAL_MAX_MISSED_PONGS"`
+
+	ConnectTimeout time.Duration `help:"Disconnect clients that have not sent Connect this long after the QUIC handshake." default:"5s" env:"HYGOAL_CONNECT_TIMEOUT"`
+	AuthTimeout    time.Duration `help:"Disconnect clients still authenticating after this long." default:"30s" env:"HYGOAL_AUTH_TIMEOUT"`
+	SetupTimeout   time.Duration `help:"Disconnect clients still in setup after this long, 0 for no limit." default:"0s" env:"HYGOAL_SETUP_TIMEOUT"`
+
+	ShutdownTimeout time.Duration `help:"Time allowed to disconnect players and save on shutdown." default:"8s" env:"HYGOAL_SHUTDOWN_TIMEOUT"`
+
+	DataDir   string   `help:"Directory for state kept across restarts, such as the self-signed certificate." default:"data" type:"path" env:"HYGOAL_DATA_DIR"`
+	Cert      string   `help:"PEM certificate file. A self-signed certificate kept in --data-dir is used when unset." type:"path" env:"HYGOAL_CERT"`
+	Key       string   `help:"PEM private key file for --cert." type:"path" env:"HYGOAL_KEY"`
+	CertHosts []string `name:"cert-host" help:"DNS names and IP addresses the self-signed certificate is issued for." default:"localhost" env:"HYGOAL_CERT_HOSTS"`
+
+	Offline      bool          `help:"Skip identity token verification and derive UUIDs from usernames. Anyone can join as anyone, only for LAN and test servers." env:"HYGOAL_OFFLINE"`
+	JWKSFile     string        `name:"jwks-file" help:"JSON Web Key Set file with the keys identity tokens are signed with." type:"path" xor:"jwks" env:"HYGOAL_JWKS_FILE"`
+	JWKSURL      string        `name:"jwks-url" help:"URL of the JSON Web Key Set identity tokens are signed with." placeholder:"URL" xor:"jwks" env:"HYGOAL_JWKS_URL"`
+	JWKSCacheTTL time.Duration `name:"jwks-cache-ttl" help:"How long keys fetched from --jwks-url are used before fetching them again." default:"1h" env:"HYGOAL_JWKS_CACHE_TTL"`
+	AuthAudience string        `help:"Audience identity tokens must be issued for." env:"HYGOAL_AUTH_AUDIENCE"`
+
+	LogLevel  slog.Level            `help:"Lowest level logged: debug, info, warn or error." default:"info" env:"HYGOAL_LOG_LEVEL"`
+	LogFormat string                `help:"Log format: text or json." enum:"text,json" default:"text" env:"HYGOAL_LOG_FORMAT"`
+	LogLevels map[string]slog.Level `help:"Levels for subsystems (network, conn, tls, auth) overriding --log-level." placeholder:"SUBSYSTEM=LEVEL" env:"HYGOAL_LOG_LEVELS"`
+
+	MetricsAddr string `help:"Address to serve Prometheus metrics on at /metrics, such as 127.0.0.1:9520. Disabled when empty." placeholder:"ADDR" env:"HYGOAL_METRICS_ADDR"`
+
+	logger *slog.Logger
+}
+
 func main() {
-	err := network.StartQuicServer()
+	// the config files are read before the flags are parsed, so the data
+	// directory holding them is looked up by hand
+	dataDir := kong.ExpandPath(config.FlagValue(os.Args[1:], "data-dir", "HYGOAL_DATA_DIR", "data"))
+	ctx := kong.Parse(&CLI,
+		kong.Description("Hygoal, a Hytale server."),
+		kong.Configuration(config.Load, config.Paths(dataDir, os.Getenv("ENV"))...),
+	)
+	ctx.FatalIfErrorf(ctx.Run())
+}
+
+// Run serves until SIGINT or SIGTERM, then shuts down gracefully.
+func (c *ServeCmd) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: c.LogLevel, Format: c.LogFormat, Levels: c.LogLevels})
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	c.logger = logger
+
+	cfg, err := c.NetworkConfig()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	server := network.NewServer(cfg)
+
+	if c.MetricsAddr != "" {
+		registry := metrics.NewRegistry()
+		server.RegisterMetrics(registry)
+		go func() {
+			logger.Info("serving metrics", "addr", c.MetricsAddr)
+			if err := metrics.Serve(ctx, c.MetricsAddr, registry); err != nil {
+				logger.Error("serving metrics failed", "err", err)
+			}
+		}()
+	}
+	return server.ListenAndServe(ctx)
+}
+
+// NetworkConfig maps the flags onto the listener settings.
+func (c *ServeCmd) NetworkConfig() (network.Config, error) {
+	authenticator, err := c.Authenticator()
+	if err != nil {
+		return network.Config{}, err
+	}
+	return network.Config{
+		Addresses:          c.Bind,
+		Port:               c.Port,
+		IPv6:               c.IPv6,
+		ALPN:               c.ALPN,
+		IdleTimeout:        c.IdleTimeout,
+		HandshakeTimeout:   c.HandshakeTimeout,
+		MaxIncomingStreams: c.MaxIncomingStreams,
+		MaxFrameSize:       c.MaxFrameSize,
+		SendQueueSize:      c.SendQueueSize,
+		ConnectionsPerIP:   c.ConnectionsPerIP,
+		ConnectionWindow:   c.ConnectionWindow,
+		MaxUnauthenticated: c.MaxUnauthenticated,
+		RetryThreshold:     c.RetryThreshold,
+		MaxStreams:         c.MaxStreams,
+		PingInterval:       c.PingInterval,
+		MaxMissedPongs:     c.MaxMissedPongs,
+		PhaseTimeouts: network.PhaseTimeouts{
+			network.PhaseConnect:        c.ConnectTimeout,
+			network.PhaseAuthentication: c.AuthTimeout,
+			network.PhaseSetup:          c.SetupTimeout,
+		},
+		ShutdownTimeout: c.ShutdownTimeout,
+		CertFile:        c.Cert,
+		KeyFile:         c.Key,
+		CertHosts:       c.CertHosts,
+		DataDir:         c.DataDir,
+		Authenticator:   authenticator,
+		Logger:          c.logger,
+	}, nil
+}
+
+// Authenticator verifies identity tokens against the configured key set,
+// or trusts every client in offline mode.
+func (c *ServeCmd) Authenticator() (auth.Authenticator, error) {
+	logger := logging.For(c.logger, logging.Auth)
+	if c.Offline {
+		logger.Warn("offline mode, identity tokens are not verified and anyone can join with any username")
+		return auth.Offline{}, nil
+	}
+
+	var keys auth.KeySource
+	switch {
+	case c.JWKSFile != "":
+		keySet, err := auth.LoadJWKSFile(c.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = keySet
+	case c.JWKSURL != "":
+		keys = &auth.RemoteJWKS{URL: c.JWKSURL, TTL: c.JWKSCacheTTL, Logger: logger}
+	default:
+		return nil, errors.New("--jwks-file or --jwks-url is required to verify identity tokens, or --offline to skip verification")
+	}
+	if c.AuthAudience == "" {
+		return nil, errors.New("--auth-audience is required to verify identity tokens")
 	}
+	return &auth.JWTAuthenticator{Keys: keys, Audience: c.AuthAudience}, nil
 }
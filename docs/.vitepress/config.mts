@@ -19,6 +19,7 @@ export default defineConfig({
                     text: 'Hygoal Documentation',
                     items: [
                         {text: 'Introduction', link: '/hygoal/'},
+                        {text: 'Configuration', link: '/hygoal/configuration'},
                     ]
                 }
             ],
@@ -29,6 +30,7 @@ export default defineConfig({
                         {text: 'Introduction', link: '/protocol/'},
                         {text: 'Data Types', link: '/protocol/datatypes'},
                         {text: 'Login', link: '/protocol/login'},
+                        {text: 'Keepalive', link: '/protocol/keepalive'},
                     ]
                 },
             ]
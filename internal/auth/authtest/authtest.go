@@ -0,0 +1,119 @@
+// Package authtest issues identity tokens signed by locally generated keys,
+// for testing the login flow.
+package authtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hygoal/internal/auth"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audience is the audience tokens are issued for by default.
+const Audience = "hygoal-test"
+
+// Issuer signs tokens with an Ed25519 key "ed" and a P-256 key "ec".
+type Issuer struct {
+	ed ed25519.PrivateKey
+	ec *ecdsa.PrivateKey
+}
+
+func NewIssuer() (*Issuer, error) {
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Issuer{ed: ed, ec: ec}, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set.
+func (i *Issuer) JWKS() []byte {
+	encode := base64.RawURLEncoding.EncodeToString
+	ecKey, err := i.ec.PublicKey.ECDH()
+	if err != nil {
+		panic(err)
+	}
+	point := ecKey.Bytes() // 0x04 || x || y
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "use": "sig", "x": encode(i.ed.Public().(ed25519.PublicKey))},
+		{"kty": "EC", "crv": "P-256", "kid": "ec", "use": "sig", "x": encode(point[1:33]), "y": encode(point[33:])},
+	}})
+	return jwks
+}
+
+// Keys returns the public keys as a key set.
+func (i *Issuer) Keys() auth.KeySet {
+	keys, err := auth.ParseJWKS(i.JWKS())
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// Claims returns claims for player, known as username, valid for an hour,
+// for Audience and bound to cert when it is not nil.
+func Claims(username string, player uuid.UUID, cert *x509.Certificate) map[string]any {
+	claims := map[string]any{
+		"sub":      player.String(),
+		"username": username,
+		"aud":      Audience,
+		"iat":      time.Now().Unix(),
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+	if cert != nil {
+		claims["cnf"] = map[string]string{"x5t#S256": auth.CertificateThumbprint(cert)}
+	}
+	return claims
+}
+
+// Sign returns claims as a token signed with the key kid, "ed" for EdDSA
+// or "ec" for ES256.
+func (i *Issuer) Sign(kid string, claims map[string]any) string {
+	var alg string
+	switch kid {
+	case "ed":
+		alg = "EdDSA"
+	case "ec":
+		alg = "ES256"
+	default:
+		panic(fmt.Sprintf("authtest: no key %q", kid))
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+	input := encode(header) + "." + encode(payload)
+	return input + "." + encode(i.signature(alg, []byte(input)))
+}
+
+func (i *Issuer) signature(alg string, input []byte) []byte {
+	if alg == "EdDSA" {
+		return ed25519.Sign(i.ed, input)
+	}
+	digest := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, i.ec, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	// JWS wants r || s, each padded to 32 bytes, not ASN.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// clockSkew is how far token times may be off from the server clock.
+const clockSkew = 30 * time.Second
+
+var (
+	// ErrInvalidSignature is returned for tokens not signed by a trusted key.
+	ErrInvalidSignature = errors.New("invalid identity token signature")
+	// ErrInvalidClaims is returned for tokens that are expired, meant for
+	// another audience or issued for another player.
+	ErrInvalidClaims = errors.New("invalid identity token")
+)
+
+// Audience is the aud claim, which JWTs may give as a string or a list.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// JWTAuthenticator verifies identity tokens signed with EdDSA (Ed25519) or
+// ES256 by a key from Keys, issued for Audience to the player in Connect
+// and bound to the client certificate. Players are known by the username
+// in the token, Connect has to claim the same one.
+type JWTAuthenticator struct {
+	Keys     KeySource
+	Audience string
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, request Request) (*Identity, error) {
+	if request.IdentityToken == "" {
+		return nil, fmt.Errorf("%w: no identity token", ErrInvalidClaims)
+	}
+	claims, err := a.Verify(ctx, request.IdentityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := uuid.Parse(claims.Subject)
+	if err != nil || subject != request.UUID {
+		return nil, fmt.Errorf("%w: issued to %q, not %s", ErrInvalidClaims, claims.Subject, request.UUID)
+	}
+	if claims.Username == "" {
+		return nil, fmt.Errorf("%w: no username", ErrInvalidClaims)
+	}
+	if claims.Username != request.Username {
+		return nil, fmt.Errorf("%w: issued to %q, not %q", ErrInvalidClaims, claims.Username, request.Username)
+	}
+	if err := claims.VerifyCertificate(request.Certificate); err != nil {
+		return nil, err
+	}
+
+	return &Identity{Username: claims.Username, UUID: subject}, nil
+}
+
+// Verify checks the signature, audience and validity period of token and
+// returns its claims.
+func (a *JWTAuthenticator) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: %d parts", ErrMalformedToken, len(parts))
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformedToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformedToken, err)
+	}
+
+	key, err := a.Keys.Key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformedToken, err)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) checkClaims(claims *Claims) error {
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("%w: no expiry", ErrInvalidClaims)
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("%w: expired", ErrInvalidClaims)
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-clockSkew)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidClaims)
+	}
+	if !slices.Contains(claims.Audience, a.Audience) {
+		return fmt.Errorf("%w: audience %v", ErrInvalidClaims, []string(claims.Audience))
+	}
+	return nil
+}
+
+func verifySignature(algorithm string, key crypto.PublicKey, input, signature []byte) error {
+	switch algorithm {
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: EdDSA token for a %T key", ErrInvalidSignature, key)
+		}
+		if !ed25519.Verify(pub, input, signature) {
+			return ErrInvalidSignature
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: ES256 token for a %T key", ErrInvalidSignature, key)
+		}
+		if len(signature) != 64 {
+			return fmt.Errorf("%w: ES256 signature of %d bytes", ErrInvalidSignature, len(signature))
+		}
+		digest := sha256.Sum256(input)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignature, algorithm)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Request is what a client presents to log in.
+type Request struct {
+	Username string
+	UUID     uuid.UUID
+	// IdentityToken is empty when Connect carried none.
+	IdentityToken string
+	// Certificate is the client certificate, nil when none was presented.
+	Certificate *x509.Certificate
+}
+
+// Identity is who a client was authenticated as.
+type Identity struct {
+	Username string
+	UUID     uuid.UUID
+}
+
+// Authenticator decides who a client logging in is.
+type Authenticator interface {
+	Authenticate(ctx context.Context, request Request) (*Identity, error)
+}
@@ -0,0 +1,130 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"hygoal/internal/auth"
+	"hygoal/internal/auth/authtest"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func clientCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := &auth.JWTAuthenticator{Keys: issuer.Keys(), Audience: authtest.Audience}
+
+	player := uuid.MustParse("0b8e8a4b-6f1e-4c2a-9d53-5d7ae1d6c3f0")
+	cert := clientCertificate(t)
+	with := func(key string, value any) map[string]any {
+		claims := authtest.Claims("Steve", player, cert)
+		claims[key] = value
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"EdDSA", issuer.Sign("ed", authtest.Claims("Steve", player, cert)), nil},
+		{"ES256", issuer.Sign("ec", authtest.Claims("Steve", player, cert)), nil},
+		{"audience list", issuer.Sign("ed", with("aud", []string{"other", authtest.Audience})), nil},
+		{"other issuer", other.Sign("ed", authtest.Claims("Steve", player, cert)), auth.ErrInvalidSignature},
+		{"expired", issuer.Sign("ed", with("exp", time.Now().Add(-time.Hour).Unix())), auth.ErrInvalidClaims},
+		{"no expiry", issuer.Sign("ed", with("exp", 0)), auth.ErrInvalidClaims},
+		{"not valid yet", issuer.Sign("ed", with("nbf", time.Now().Add(time.Hour).Unix())), auth.ErrInvalidClaims},
+		{"other audience", issuer.Sign("ec", with("aud", "other")), auth.ErrInvalidClaims},
+		{"other player", issuer.Sign("ed", with("sub", uuid.New().String())), auth.ErrInvalidClaims},
+		{"other username", issuer.Sign("ed", with("username", "Alex")), auth.ErrInvalidClaims},
+		{"no username", issuer.Sign("ed", with("username", "")), auth.ErrInvalidClaims},
+		{"unbound", issuer.Sign("ed", authtest.Claims("Steve", player, nil)), auth.ErrCertificateMismatch},
+		{"other certificate", issuer.Sign("ed", authtest.Claims("Steve", player, clientCertificate(t))), auth.ErrCertificateMismatch},
+		{"no token", "", auth.ErrInvalidClaims},
+		{"malformed", "a.b", auth.ErrMalformedToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := authenticator.Authenticate(context.Background(), auth.Request{
+				Username:      "Steve",
+				UUID:          player,
+				IdentityToken: test.token,
+				Certificate:   cert,
+			})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			if err == nil && (identity.UUID != player || identity.Username != "Steve") {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorTampered(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := &auth.JWTAuthenticator{Keys: issuer.Keys(), Audience: authtest.Audience}
+
+	player := uuid.New()
+	signed := strings.Split(issuer.Sign("ed", authtest.Claims("Steve", player, nil)), ".")
+	forged := strings.Split(issuer.Sign("ed", authtest.Claims("Steve", uuid.New(), nil)), ".")
+
+	// the claims of one token with the signature of another
+	token := signed[0] + "." + forged[1] + "." + signed[2]
+	if _, err := authenticator.Verify(context.Background(), token); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Errorf("tampered claims: %v", err)
+	}
+	// an EdDSA signature claimed to be ES256
+	ecHeader := strings.Split(issuer.Sign("ec", authtest.Claims("Steve", player, nil)), ".")[0]
+	token = ecHeader + "." + signed[1] + "." + signed[2]
+	if _, err := authenticator.Verify(context.Background(), token); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Errorf("algorithm swapped: %v", err)
+	}
+	// the none algorithm is never accepted
+	token = "eyJhbGciOiJub25lIiwia2lkIjoiZWQifQ." + signed[1] + "."
+	if _, err := authenticator.Verify(context.Background(), token); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Errorf("alg none: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrUnknownKey is returned for tokens signed by a key not in the key set.
+var ErrUnknownKey = errors.New("identity token signed by an unknown key")
+
+const (
+	// DefaultJWKSCacheTTL is how long a fetched key set is used before it
+	// is fetched again.
+	DefaultJWKSCacheTTL = time.Hour
+	// DefaultJWKSFetchTimeout bounds fetching the key set, so a slow
+	// endpoint does not hold up logins for long.
+	DefaultJWKSFetchTimeout = 10 * time.Second
+	// jwksRefreshInterval throttles refetching for unknown key IDs and
+	// after failed fetches, so clients cannot make the server hammer the
+	// endpoint.
+	jwksRefreshInterval = 30 * time.Second
+	// maxJWKSSize bounds the key set read from a file or endpoint.
+	maxJWKSSize = 1 << 20
+)
+
+// KeySource looks up the public key identity tokens were signed with.
+type KeySource interface {
+	// Key returns the key with id, or the only key when id is empty.
+	Key(ctx context.Context, id string) (crypto.PublicKey, error)
+}
+
+// KeySet is a parsed JSON Web Key Set, keyed by key ID.
+type KeySet map[string]crypto.PublicKey
+
+func (k KeySet) Key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	if key, ok := k[id]; ok {
+		return key, nil
+	}
+	if id == "" && len(k) == 1 {
+		for _, key := range k {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// ParseJWKS parses a JSON Web Key Set. Ed25519 (OKP) and P-256 (EC) keys
+// are kept; keys of other types, or not meant for signatures, are skipped.
+func ParseJWKS(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	keys := KeySet{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWKS key %q: %w", jwk.KeyID, err)
+		}
+		if key != nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no Ed25519 or P-256 signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey returns the key, nil for unsupported key types.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+
+	switch {
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Ed25519 key of %d bytes", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	case k.KeyType == "EC" && k.Curve == "P-256":
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on P-256")
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+// LoadJWKSFile reads the key set at name.
+func LoadJWKSFile(name string) (KeySet, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return keys, nil
+}
+
+// RemoteJWKS fetches the key set from an HTTP endpoint and caches it for
+// TTL. Tokens with an unknown key ID refetch it early, at most every 30
+// seconds, to pick up rotated keys. When a refetch fails the cached keys
+// stay in use and the fetch is retried 30 seconds later, timeouts
+// included.
+//
+// Only one fetch runs at a time, and callers waiting for it give up when
+// their context ends without cancelling it for the others.
+type RemoteJWKS struct {
+	URL string
+	// TTL defaults to DefaultJWKSCacheTTL.
+	TTL time.Duration
+	// FetchTimeout bounds a fetch, DefaultJWKSFetchTimeout when 0.
+	FetchTimeout time.Duration
+	// Client defaults to a client with FetchTimeout as its timeout.
+	Client *http.Client
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+
+	flight singleflight.Group
+
+	mu   sync.Mutex
+	keys KeySet
+	// fetchedAt is when keys were fetched, lastAttempt when the last
+	// fetch finished, successful or not
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func (r *RemoteJWKS) Key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultJWKSCacheTTL
+	}
+	keys, age, sinceAttempt := r.cached()
+	// the last fetch failed when it finished after the keys were fetched
+	failedRecently := sinceAttempt < age && sinceAttempt < jwksRefreshInterval
+	if age >= ttl && !failedRecently {
+		var err error
+		if keys, err = r.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("no JWKS from %s", r.URL)
+	}
+
+	key, err := keys.Key(ctx, id)
+	if _, _, sinceAttempt := r.cached(); errors.Is(err, ErrUnknownKey) && sinceAttempt >= jwksRefreshInterval {
+		if keys, err = r.refresh(ctx); err != nil {
+			return nil, err
+		}
+		key, err = keys.Key(ctx, id)
+	}
+	return key, err
+}
+
+// cached returns the cached keys, how long ago they were fetched and how
+// long ago the last fetch finished.
+func (r *RemoteJWKS) cached() (KeySet, time.Duration, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys, time.Since(r.fetchedAt), time.Since(r.lastAttempt)
+}
+
+// refresh fetches the key set, or joins the fetch already running, and
+// returns the keys cached afterwards. It returns early once ctx is done.
+func (r *RemoteJWKS) refresh(ctx context.Context) (KeySet, error) {
+	done := r.flight.DoChan("jwks", func() (any, error) {
+		r.update()
+		return nil, nil
+	})
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	keys, _, _ := r.cached()
+	if keys == nil {
+		return nil, fmt.Errorf("no JWKS from %s", r.URL)
+	}
+	return keys, nil
+}
+
+// update fetches the key set, detached from the callers waiting for it.
+func (r *RemoteJWKS) update() {
+	timeout := r.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultJWKSFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	keys, err := r.fetch(ctx, timeout)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastAttempt = time.Now()
+	if err != nil {
+		logger := r.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		logger.Error("fetching JWKS failed", "url", r.URL, "err", err)
+		return
+	}
+	r.keys = keys
+	r.fetchedAt = r.lastAttempt
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context, timeout time.Duration) (KeySet, error) {
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
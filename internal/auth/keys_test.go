@@ -0,0 +1,206 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"hygoal/internal/auth"
+	"hygoal/internal/auth/authtest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseJWKS(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.ParseJWKS(issuer.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("%d keys", len(keys))
+	}
+	if _, err := keys.Key(context.Background(), "nope"); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("unknown kid: %v", err)
+	}
+
+	for _, jwks := range []string{
+		`{`,
+		`{"keys":[]}`,
+		`{"keys":[{"kty":"RSA","kid":"rsa","n":"AQAB","e":"AQAB"}]}`,
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"short","x":"AQAB"}]}`,
+		`{"keys":[{"kty":"EC","crv":"P-256","kid":"off","x":"AQAB","y":"AQAB"}]}`,
+	} {
+		if _, err := auth.ParseJWKS([]byte(jwks)); err == nil {
+			t.Errorf("ParseJWKS(%s) accepted", jwks)
+		}
+	}
+}
+
+func TestKeySetSingleKey(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := issuer.Keys()
+	delete(keys, "ec")
+
+	// tokens without kid use the only key there is
+	if _, err := keys.Key(context.Background(), ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadJWKSFile(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(name, issuer.JWKS(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := auth.LoadJWKSFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Key(context.Background(), "ed"); err != nil {
+		t.Error(err)
+	}
+	if _, err := auth.LoadJWKSFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(issuer.JWKS())
+	}))
+	defer endpoint.Close()
+
+	remote := &auth.RemoteJWKS{URL: endpoint.URL}
+	ctx := context.Background()
+	for range 3 {
+		if _, err := remote.Key(ctx, "ed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("fetched %d times, want the cached keys used", fetches.Load())
+	}
+
+	// unknown key IDs right after a fetch do not refetch
+	if _, err := remote.Key(ctx, "rotated"); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("unknown kid: %v", err)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("fetched %d times after an unknown kid", fetches.Load())
+	}
+
+	// the endpoint going down keeps the cached keys in use
+	failing.Store(true)
+	expired := &auth.RemoteJWKS{URL: endpoint.URL, TTL: 1}
+	if _, err := expired.Key(ctx, "ed"); err == nil {
+		t.Error("key without a reachable endpoint")
+	}
+	remote.TTL = 1
+	before := fetches.Load()
+	for range 3 {
+		if _, err := remote.Key(ctx, "ed"); err != nil {
+			t.Errorf("cached keys dropped after a failed refetch: %v", err)
+		}
+	}
+	if fetches.Load() != before+1 {
+		t.Errorf("fetched %d times while failing, want the retries throttled", fetches.Load()-before)
+	}
+}
+
+func TestRemoteJWKSHanging(t *testing.T) {
+	var fetches atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-r.Context().Done()
+	}))
+	defer endpoint.Close()
+
+	remote := &auth.RemoteJWKS{URL: endpoint.URL, FetchTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := remote.Key(context.Background(), "ed"); err == nil {
+		t.Fatal("key from a hanging endpoint")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fetch took %v", elapsed)
+	}
+
+	// a timed out fetch is throttled like any failure, the logins after
+	// it fail straight away
+	start = time.Now()
+	for range 3 {
+		if _, err := remote.Key(context.Background(), "ed"); err == nil {
+			t.Error("key after a timed out fetch")
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond || fetches.Load() != 1 {
+		t.Errorf("%d fetches in %v, want the retries throttled", fetches.Load(), elapsed)
+	}
+}
+
+func TestRemoteJWKSCancelled(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Write(issuer.JWKS())
+	}))
+	defer endpoint.Close()
+
+	remote := &auth.RemoteJWKS{URL: endpoint.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := remote.Key(ctx, "ed"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("cancelled caller got %v", err)
+	}
+
+	// the caller giving up did not cancel the fetch, others join it
+	done := make(chan error, 1)
+	go func() {
+		_, err := remote.Key(context.Background(), "ed")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting caller never got the keys")
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("fetched %d times, want the fetch shared", fetches.Load())
+	}
+}
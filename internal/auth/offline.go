@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+	"crypto/md5"
+
+	"github.com/google/uuid"
+)
+
+// Offline accepts every client without checking its identity token, as
+// whoever it claims to be. It is only meant for LAN and test servers:
+// anyone can join with any username.
+type Offline struct{}
+
+func (Offline) Authenticate(ctx context.Context, request Request) (*Identity, error) {
+	return &Identity{Username: request.Username, UUID: OfflineUUID(request.Username)}, nil
+}
+
+// OfflineUUID derives a stable UUID from username, the name-based (version
+// 3) UUID of "OfflinePlayer:" + username, so players keep their data across
+// logins and do not collide with UUIDs of authenticated players.
+func OfflineUUID(username string) uuid.UUID {
+	var id uuid.UUID
+	sum := md5.Sum([]byte("OfflinePlayer:" + username))
+	copy(id[:], sum[:])
+	id[6] = id[6]&0x0f | 0x30 // version 3
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestOfflineUUID(t *testing.T) {
+	// Java's UUID.nameUUIDFromBytes("OfflinePlayer:Notch")
+	if id := OfflineUUID("Notch"); id.String() != "b50ad385-829d-3141-a216-7e7d7539ba7f" {
+		t.Errorf("OfflineUUID(Notch) = %s", id)
+	}
+	if OfflineUUID("Notch") == OfflineUUID("notch") {
+		t.Error("usernames differing in case share a UUID")
+	}
+
+	identity, err := Offline{}.Authenticate(context.Background(), Request{Username: "Notch", UUID: uuid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "Notch" || identity.UUID != OfflineUUID("Notch") {
+		t.Errorf("identity = %+v", identity)
+	}
+}
@@ -0,0 +1,77 @@
+// Package auth checks the identity tokens clients present in Connect.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMalformedToken is returned for tokens that are not a JWT.
+	ErrMalformedToken = errors.New("malformed identity token")
+	// ErrCertificateMismatch is returned when a token is bound to another
+	// certificate than the one the client presented, or to none.
+	ErrCertificateMismatch = errors.New("identity token is not bound to the client certificate")
+)
+
+// Claims are the identity token claims the server checks.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Username  string   `json:"username"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	// Confirmation binds the token to the client certificate, following
+	// RFC 8705.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+// Confirmation holds the certificate thumbprint a token is bound to.
+type Confirmation struct {
+	CertificateThumbprint string `json:"x5t#S256"`
+}
+
+// ParseUnverified reads the claims of token without checking its signature.
+func ParseUnverified(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: %d parts", ErrMalformedToken, len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrMalformedToken, err)
+	}
+
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformedToken, err)
+	}
+	return claims, nil
+}
+
+// CertificateThumbprint returns the x5t#S256 thumbprint of cert, the
+// unpadded base64url SHA-256 of its DER encoding.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCertificate checks that the token is bound to cert, so a token
+// replayed from another connection is refused.
+func (c *Claims) VerifyCertificate(cert *x509.Certificate) error {
+	if c.Confirmation == nil || c.Confirmation.CertificateThumbprint == "" {
+		return fmt.Errorf("%w: token has no certificate thumbprint", ErrCertificateMismatch)
+	}
+	if cert == nil {
+		return fmt.Errorf("%w: client presented no certificate", ErrCertificateMismatch)
+	}
+	if c.Confirmation.CertificateThumbprint != CertificateThumbprint(cert) {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func unsignedToken(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(claims)) + "."
+}
+
+func TestParseUnverified(t *testing.T) {
+	claims, err := ParseUnverified(unsignedToken(`{"sub":"0b8e8a4b-6f1e-4c2a-9d53-5d7ae1d6c3f0","cnf":{"x5t#S256":"abc"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "0b8e8a4b-6f1e-4c2a-9d53-5d7ae1d6c3f0" || claims.Confirmation.CertificateThumbprint != "abc" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	for _, token := range []string{"", "a.b", "a.!!!.c", unsignedToken(`[1]`), unsignedToken(`{"sub":1}`)} {
+		if _, err := ParseUnverified(token); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("ParseUnverified(%q) = %v", token, err)
+		}
+	}
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	cert, other := testCertificate(t), testCertificate(t)
+	bound := &Claims{Confirmation: &Confirmation{CertificateThumbprint: CertificateThumbprint(cert)}}
+
+	if err := bound.VerifyCertificate(cert); err != nil {
+		t.Errorf("matching certificate refused: %v", err)
+	}
+	if err := bound.VerifyCertificate(other); !errors.Is(err, ErrCertificateMismatch) {
+		t.Errorf("other certificate: %v", err)
+	}
+	if err := bound.VerifyCertificate(nil); !errors.Is(err, ErrCertificateMismatch) {
+		t.Errorf("no certificate: %v", err)
+	}
+	if err := (&Claims{}).VerifyCertificate(cert); !errors.Is(err, ErrCertificateMismatch) {
+		t.Errorf("unbound token: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package config loads hygoal configuration files as kong resolvers, so a
+// file only fills in flags that were not given on the command line.
+//
+// Keys follow the flag names with '-' written as '_', e.g. idle_timeout for
+// --idle-timeout. A flag whose environment variable is set is never read from
+// a file, which makes the precedence: flags, environment, files, defaults.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/kong"
+	"github.com/goccy/go-yaml"
+)
+
+// Load is a kong.ConfigurationLoader that picks YAML or TOML by the file
+// extension of r, falling back to YAML for readers without a name.
+func Load(r io.Reader) (kong.Resolver, error) {
+	if named, ok := r.(interface{ Name() string }); ok {
+		if strings.EqualFold(filepath.Ext(named.Name()), ".toml") {
+			return TOML(r)
+		}
+	}
+	return YAML(r)
+}
+
+// YAML returns a resolver reading values from a YAML document.
+func YAML(r io.Reader) (kong.Resolver, error) {
+	values := map[string]any{}
+	err := yaml.NewDecoder(r).Decode(&values)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return resolver(values), nil
+}
+
+// TOML returns a resolver reading values from a TOML document.
+func TOML(r io.Reader) (kong.Resolver, error) {
+	values := map[string]any{}
+	if _, err := toml.NewDecoder(r).Decode(&values); err != nil {
+		return nil, err
+	}
+	return resolver(values), nil
+}
+
+// Paths lists the configuration files hygoal reads from dir when present:
+// hygoal.yaml or hygoal.toml, then hygoal.<env>.yaml or hygoal.<env>.toml,
+// with later files taking precedence.
+func Paths(dir, env string) []string {
+	paths := []string{
+		filepath.Join(dir, "hygoal.yaml"),
+		filepath.Join(dir, "hygoal.toml"),
+	}
+	if env != "" {
+		paths = append(paths,
+			filepath.Join(dir, "hygoal."+env+".yaml"),
+			filepath.Join(dir, "hygoal."+env+".toml"),
+		)
+	}
+	return paths
+}
+
+// FlagValue returns the value given for the flag name on the command line
+// args, as "--name value" or "--name=value", then envVar, then fallback.
+// It is for flags needed before kong parses the rest, such as the
+// directory the config files are read from.
+func FlagValue(args []string, name, envVar, fallback string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--"+name+"="); ok {
+			return value
+		}
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	if value, ok := os.LookupEnv(envVar); ok {
+		return value
+	}
+	return fallback
+}
+
+// resolver looks flags up the way kong.JSON does: by the flag name with '-'
+// replaced by '_', by its camelCase form, then through nested tables for
+// dotted names.
+func resolver(values map[string]any) kong.Resolver {
+	return kong.ResolverFunc(func(context *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+		for _, env := range flag.Envs {
+			if _, ok := os.LookupEnv(env); ok {
+				return nil, nil
+			}
+		}
+
+		name := strings.ReplaceAll(flag.Name, "-", "_")
+		if raw, ok := values[name]; ok {
+			return normalize(flag, raw)
+		}
+		if raw, ok := values[camelCase(flag.Name)]; ok {
+			return normalize(flag, raw)
+		}
+
+		var raw any = values
+		for _, part := range strings.Split(name, ".") {
+			table, ok := raw.(map[string]any)
+			if !ok {
+				return nil, nil
+			}
+			if raw, ok = table[part]; !ok {
+				return nil, nil
+			}
+		}
+		return normalize(flag, raw)
+	})
+}
+
+// normalize turns decoded lists into the []any kong expects from resolvers.
+// Tables are only values for map flags.
+func normalize(flag *kong.Flag, raw any) (any, error) {
+	switch value := raw.(type) {
+	case []any:
+		return value, nil
+	case []string:
+		list := make([]any, len(value))
+		for i, s := range value {
+			list[i] = s
+		}
+		return list, nil
+	case map[string]any:
+		if flag.Target.Kind() == reflect.Map {
+			return value, nil
+		}
+		return nil, fmt.Errorf("expected a value but got a table")
+	}
+	return raw, nil
+}
+
+func camelCase(name string) string {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
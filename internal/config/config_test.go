@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+type testCLI struct {
+	Config kong.ConfigFlag `short:"c"`
+
+	Bind        []string      `env:"TEST_BIND"`
+	Port        int           `default:"5520" env:"TEST_PORT"`
+	IPv6        bool          `name:"ipv6"`
+	IdleTimeout time.Duration `default:"30s"`
+	Levels      map[string]string
+	Quic        struct {
+		MaxStreams int64 `default:"100"`
+	} `embed:"" prefix:"quic."`
+}
+
+func parse(t *testing.T, args []string, paths ...string) testCLI {
+	t.Helper()
+
+	var cli testCLI
+	parser, err := kong.New(&cli, kong.Configuration(Load, paths...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestYAML(t *testing.T) {
+	path := writeFile(t, "hygoal.yaml", `
+bind: [127.0.0.1, "::1"]
+port: 25565
+ipv6: true
+idle_timeout: 1m
+quic:
+  max_streams: 8
+levels:
+  conn: debug
+`)
+
+	cli := parse(t, nil, path)
+	if !reflect.DeepEqual(cli.Bind, []string{"127.0.0.1", "::1"}) {
+		t.Errorf("bind = %v", cli.Bind)
+	}
+	if cli.Port != 25565 || !cli.IPv6 || cli.IdleTimeout != time.Minute || cli.Quic.MaxStreams != 8 {
+		t.Errorf("unexpected config %+v", cli)
+	}
+	if !reflect.DeepEqual(cli.Levels, map[string]string{"conn": "debug"}) {
+		t.Errorf("levels = %v", cli.Levels)
+	}
+}
+
+func TestTOML(t *testing.T) {
+	path := writeFile(t, "hygoal.toml", `
+# listener
+bind = [
+	"127.0.0.1", # loopback
+	'::1',
+]
+port = 25_565
+ipv6 = true
+idle_timeout = "1m"
+
+quic.max_streams = 8
+levels = { conn = "debug" }
+`)
+
+	cli := parse(t, nil, path)
+	if !reflect.DeepEqual(cli.Bind, []string{"127.0.0.1", "::1"}) {
+		t.Errorf("bind = %v", cli.Bind)
+	}
+	if cli.Port != 25565 || !cli.IPv6 || cli.IdleTimeout != time.Minute || cli.Quic.MaxStreams != 8 {
+		t.Errorf("unexpected config %+v", cli)
+	}
+	if !reflect.DeepEqual(cli.Levels, map[string]string{"conn": "debug"}) {
+		t.Errorf("levels = %v", cli.Levels)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	base := writeFile(t, "hygoal.yaml", "port: 1\nbind: [10.0.0.1]\nidle_timeout: 5s\n")
+	env := writeFile(t, "hygoal.production.toml", "port = 2\n")
+	flagged := writeFile(t, "override.yaml", "idle_timeout: 7s\n")
+
+	cli := parse(t, nil, base, env)
+	if cli.Port != 2 || cli.IdleTimeout != 5*time.Second {
+		t.Errorf("later files should win: %+v", cli)
+	}
+
+	cli = parse(t, []string{"--config", flagged}, base, env)
+	if cli.IdleTimeout != 7*time.Second {
+		t.Errorf("--config should win over default paths: %+v", cli)
+	}
+
+	t.Setenv("TEST_PORT", "3")
+	t.Setenv("TEST_BIND", "10.0.0.2")
+	cli = parse(t, nil, base, env)
+	if cli.Port != 3 || !reflect.DeepEqual(cli.Bind, []string{"10.0.0.2"}) {
+		t.Errorf("environment should win over files: %+v", cli)
+	}
+
+	cli = parse(t, []string{"--port", "4"}, base, env)
+	if cli.Port != 4 {
+		t.Errorf("flags should win over environment: %+v", cli)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	got := Paths("data", "production")
+	want := []string{"data/hygoal.yaml", "data/hygoal.toml", "data/hygoal.production.yaml", "data/hygoal.production.toml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths = %v, want %v", got, want)
+	}
+	if got := Paths("data", ""); len(got) != 2 {
+		t.Errorf("Paths without env = %v", got)
+	}
+}
+
+func TestFlagValue(t *testing.T) {
+	t.Setenv("HYGOAL_TEST_DIR", "env")
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"serve", "--data-dir", "flag"}, "flag"},
+		{[]string{"serve", "--data-dir=flag", "--port", "1"}, "flag"},
+		{[]string{"serve", "--", "--data-dir", "arg"}, "env"},
+		{[]string{"serve", "--data-dir"}, "env"},
+	} {
+		if got := FlagValue(test.args, "data-dir", "HYGOAL_TEST_DIR", "data"); got != test.want {
+			t.Errorf("FlagValue(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+	if got := FlagValue(nil, "data-dir", "HYGOAL_UNSET_DIR", "data"); got != "data" {
+		t.Errorf("FlagValue without flag or environment = %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+// Package logging sets up the server's structured logger, with levels
+// that can be raised or lowered per subsystem.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// SubsystemKey is the attribute naming the part of the server a logger
+// belongs to.
+const SubsystemKey = "subsystem"
+
+// Subsystems logging through For.
+const (
+	// Network is the listener, admission and shutdown.
+	Network = "network"
+	// Conn is everything about a single connection.
+	Conn = "conn"
+	// TLS is certificate generation and reloading.
+	TLS = "tls"
+	// Auth is identity token verification.
+	Auth = "auth"
+)
+
+// Config selects the log format and levels.
+type Config struct {
+	Level slog.Level
+	// Format is "text" or "json", text when empty.
+	Format string
+	// Levels overrides Level for subsystems.
+	Levels map[string]slog.Level
+}
+
+// New returns a logger writing to w as configured.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	lowest := cfg.Level
+	for _, level := range cfg.Levels {
+		lowest = min(lowest, level)
+	}
+	// the handler lets everything through, levelHandler filters
+	opts := &slog.HandlerOptions{Level: lowest}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	return slog.New(&levelHandler{handler: handler, level: cfg.Level, levels: cfg.Levels}), nil
+}
+
+// For returns logger tagged with subsystem, logging at the level
+// configured for it.
+func For(logger *slog.Logger, subsystem string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(SubsystemKey, subsystem)
+}
+
+// levelHandler applies the level of the subsystem its logger was tagged
+// with.
+type levelHandler struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	level := h.level
+	for _, attr := range attrs {
+		if attr.Key != SubsystemKey {
+			continue
+		}
+		if override, ok := h.levels[attr.Value.String()]; ok {
+			level = override
+		}
+	}
+	return &levelHandler{handler: h.handler.WithAttrs(attrs), level: level, levels: h.levels}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{handler: h.handler.WithGroup(name), level: h.level, levels: h.levels}
+}
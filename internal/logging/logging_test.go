@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSubsystemLevels(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, Config{
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{Conn: slog.LevelDebug, TLS: slog.LevelError},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Debug("root debug")
+	logger.Info("root info")
+	For(logger, Conn).With("conn", 1).Debug("conn debug")
+	For(logger, TLS).Warn("tls warn")
+	For(logger, Network).Debug("network debug")
+
+	got := out.String()
+	for _, want := range []string{"root info", "conn debug", "subsystem=conn conn=1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q missing from\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"root debug", "tls warn", "network debug"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("%q logged\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, Config{Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	For(logger, Auth).Info("authenticated", "username", "Steve")
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "authenticated" || record[SubsystemKey] != Auth || record["username"] != "Steve" {
+		t.Errorf("record = %v", record)
+	}
+
+	if _, err := New(&out, Config{Format: "xml"}); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,186 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"hygoal/internal/auth"
+	"hygoal/internal/logging"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// DefaultShutdownTimeout leaves room within the 10 seconds docker stop
+// waits before killing the server.
+const DefaultShutdownTimeout = 8 * time.Second
+
+// Config describes how the server listens for QUIC connections.
+type Config struct {
+	// Addresses to bind, all interfaces when empty.
+	Addresses []string
+	Port      int
+	// IPv6 allows IPv6 addresses; with no Addresses the server then binds
+	// the dual-stack wildcard instead of 0.0.0.0.
+	IPv6 bool
+	ALPN []string
+
+	IdleTimeout        time.Duration
+	HandshakeTimeout   time.Duration
+	MaxIncomingStreams int64
+	// MaxFrameSize bounds the payload of a single frame in bytes, on top of
+	// each packet's own maximum.
+	MaxFrameSize int
+	// SendQueueSize is the number of outbound packets buffered per
+	// stream before senders block.
+	SendQueueSize int
+	// StreamRoutes picks the stream each packet is sent on, the control
+	// stream for packets without a route.
+	StreamRoutes StreamRoutes
+	// PhaseTimeouts bounds how long a connection may stay in each phase.
+	PhaseTimeouts PhaseTimeouts
+	// ConnectionsPerIP bounds the connections one IP address may open per
+	// ConnectionWindow, no limit when 0. The window defaults to
+	// DefaultConnectionWindow.
+	ConnectionsPerIP int
+	ConnectionWindow time.Duration
+	// MaxUnauthenticated bounds the connections still in the handshake or
+	// logging in, no limit when 0.
+	MaxUnauthenticated int
+	// RetryThreshold is the number of unauthenticated connections from
+	// which new clients must validate their address with a QUIC Retry
+	// first, never when 0.
+	RetryThreshold int
+	// MaxStreams bounds the streams a client may open over a connection,
+	// no limit when 0.
+	MaxStreams int
+	// PingInterval is how often authenticated clients are pinged to
+	// measure their round trip, never when 0.
+	PingInterval time.Duration
+	// MaxMissedPongs disconnects clients that left that many pings in a
+	// row unanswered, never when 0.
+	MaxMissedPongs int
+	// ShutdownTimeout bounds disconnecting players and saving on shutdown,
+	// DefaultShutdownTimeout when 0.
+	ShutdownTimeout time.Duration
+
+	// CertFile and KeyFile hold a PEM certificate and key. When both are
+	// empty a self-signed certificate for CertHosts is generated once and
+	// kept in DataDir, or only in memory without a DataDir.
+	CertFile  string
+	KeyFile   string
+	CertHosts []string
+	DataDir   string
+
+	// Authenticator decides who clients logging in are. It is required.
+	Authenticator auth.Authenticator
+	// Logger is tagged with the subsystem of each message, slog.Default
+	// when nil.
+	Logger *slog.Logger
+}
+
+// logger returns the logger for subsystem.
+func (c Config) logger(subsystem string) *slog.Logger {
+	return logging.For(c.Logger, subsystem)
+}
+
+// ListenAddrs resolves the UDP addresses to bind.
+func (c Config) ListenAddrs() ([]*net.UDPAddr, error) {
+	if c.Port < 0 || c.Port > 65535 {
+		return nil, fmt.Errorf("port %d out of range", c.Port)
+	}
+
+	hosts := c.Addresses
+	if len(hosts) == 0 {
+		if c.IPv6 {
+			hosts = []string{"::"}
+		} else {
+			hosts = []string{"0.0.0.0"}
+		}
+	}
+
+	addrs := make([]*net.UDPAddr, 0, len(hosts))
+	for _, host := range hosts {
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(c.Port)))
+		if err != nil {
+			return nil, fmt.Errorf("bind address %q: %w", host, err)
+		}
+		if addr.IP.To4() == nil && addr.IP != nil && !c.IPv6 {
+			return nil, fmt.Errorf("bind address %q is IPv6 but IPv6 is disabled", host)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func (c Config) network() string {
+	if c.IPv6 {
+		return "udp"
+	}
+	return "udp4"
+}
+
+// QUICConfig returns the quic-go settings for the listener.
+func (c Config) QUICConfig() *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:       c.IdleTimeout,
+		HandshakeIdleTimeout: c.HandshakeTimeout,
+		MaxIncomingStreams:   c.MaxIncomingStreams,
+		// clients only open bidirectional streams
+		MaxIncomingUniStreams: -1,
+		// packets marked unreliable go in datagrams
+		EnableDatagrams: true,
+	}
+}
+
+// TLSConfig serves the configured certificate, or a self-signed one kept
+// in DataDir, and offers the configured ALPN protocols.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if len(c.ALPN) == 0 {
+		return nil, fmt.Errorf("at least one ALPN protocol is required")
+	}
+
+	certFile, keyFile := c.CertFile, c.KeyFile
+	switch {
+	case certFile != "" && keyFile != "":
+	case certFile != "" || keyFile != "":
+		return nil, fmt.Errorf("certificate and key must be given together")
+	case c.DataDir == "":
+		cert, err := NewSelfSignedServerCert(c.certHosts()...)
+		if err != nil {
+			return nil, fmt.Errorf("generating self-signed cert: %w", err)
+		}
+		c.logger(logging.TLS).Info("using a temporary self-signed TLS certificate", "fingerprint", Fingerprint(cert.Leaf))
+		tlsConf := NewQUICServerTLSConfig(func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil })
+		tlsConf.NextProtos = c.ALPN
+		return tlsConf, nil
+	default:
+		certFile = filepath.Join(c.DataDir, "cert.pem")
+		keyFile = filepath.Join(c.DataDir, "key.pem")
+		generated, err := EnsureSelfSignedCert(certFile, keyFile, c.certHosts())
+		if err != nil {
+			return nil, fmt.Errorf("generating self-signed cert: %w", err)
+		}
+		if generated {
+			c.logger(logging.TLS).Info("generated self-signed TLS certificate", "file", certFile, "hosts", c.certHosts())
+		}
+	}
+
+	certs, err := NewCertReloader(certFile, keyFile, c.logger(logging.TLS))
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+	tlsConf := NewQUICServerTLSConfig(certs.GetCertificate)
+	tlsConf.NextProtos = c.ALPN
+	return tlsConf, nil
+}
+
+func (c Config) certHosts() []string {
+	if len(c.CertHosts) == 0 {
+		return []string{"localhost"}
+	}
+	return c.CertHosts
+}
@@ -0,0 +1,59 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListenAddrs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{"wildcard", Config{Port: 5520}, []string{"0.0.0.0:5520"}},
+		{"dual stack", Config{Port: 5520, IPv6: true}, []string{"[::]:5520"}},
+		{"explicit", Config{Port: 1, Addresses: []string{"127.0.0.1", "::1"}, IPv6: true}, []string{"127.0.0.1:1", "[::1]:1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addrs, err := test.config.ListenAddrs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != len(test.want) {
+				t.Fatalf("got %v, want %v", addrs, test.want)
+			}
+			for i, addr := range addrs {
+				if addr.String() != test.want[i] {
+					t.Errorf("address %d = %s, want %s", i, addr, test.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := (Config{Port: 5520, Addresses: []string{"::1"}}).ListenAddrs(); err == nil {
+		t.Error("IPv6 address accepted with IPv6 disabled")
+	}
+	if _, err := (Config{Port: 70000}).ListenAddrs(); err == nil {
+		t.Error("out of range port accepted")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	config := Config{ALPN: []string{"hytale/2", "hytale/1"}, IdleTimeout: time.Minute}
+	tlsConf, err := config.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsConf.NextProtos) != 2 || tlsConf.NextProtos[0] != "hytale/2" {
+		t.Errorf("NextProtos = %v", tlsConf.NextProtos)
+	}
+
+	if _, err := (Config{ALPN: []string{"hytale/1"}, CertFile: "cert.pem"}).TLSConfig(); err == nil {
+		t.Error("certificate without key accepted")
+	}
+	if _, err := (Config{}).TLSConfig(); err == nil {
+		t.Error("empty ALPN list accepted")
+	}
+}
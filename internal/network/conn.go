@@ -0,0 +1,363 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"hygoal/internal/protocol"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// DefaultSendQueueSize is the number of frames a connection buffers per
+// stream before Send blocks.
+const DefaultSendQueueSize = 256
+
+// ErrConnClosed is returned when sending on a closed connection.
+var ErrConnClosed = errors.New("connection closed")
+
+// Conn wraps a QUIC connection with packet level sending. Packets are
+// encoded by the caller of Send and queued for the stream their route
+// picks, where a writer goroutine per stream writes them in order. Packets
+// on different streams are not ordered with each other. When a queue is
+// full Send blocks until its writer catches up.
+//
+// Packets marked unreliable in the schema skip the queue and go out as
+// datagrams straight away, unless the client does not support datagrams or
+// the packet does not fit in one.
+type Conn struct {
+	*quic.Conn
+
+	maxFrameSize int
+	// metrics counts the frames written, nil when not counted
+	metrics *Metrics
+	// routes picks the stream each packet is written on
+	routes StreamRoutes
+	// lookup describes the packets sent and received, protocol.LookupID
+	// unless a test replaces it
+	lookup func(id uint32) (protocol.PacketInfo, bool)
+	// writers has a writer per stream role. Only the control writer
+	// queues packets before its stream is attached.
+	writers [streamRoles]*streamWriter
+
+	mu      sync.Mutex
+	waiters map[uint32][]chan protocol.Packet
+
+	// closing stops new packets while queued ones are still written,
+	// closed stops everything
+	closing     chan struct{}
+	closingOnce sync.Once
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+// streamWriter queues the frames written on one stream.
+type streamWriter struct {
+	queue chan outbound
+	// stream is set under Conn.mu once attached
+	stream *quic.Stream
+	// done is closed when the writer goroutine has exited
+	done chan struct{}
+}
+
+// outbound is a queued frame, or a flush marker when frame is nil.
+type outbound struct {
+	frame []byte
+	done  chan error
+}
+
+// NewConn wraps conn, buffering up to queueSize frames per stream before
+// Send blocks, DefaultSendQueueSize when queueSize is 0.
+func NewConn(conn *quic.Conn, maxFrameSize, queueSize int) *Conn {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultSendQueueSize
+	}
+	c := &Conn{
+		Conn:         conn,
+		maxFrameSize: maxFrameSize,
+		lookup:       protocol.LookupID,
+		waiters:      map[uint32][]chan protocol.Packet{},
+		closing:      make(chan struct{}),
+		closed:       make(chan struct{}),
+	}
+	for i := range c.writers {
+		c.writers[i] = &streamWriter{queue: make(chan outbound, queueSize), done: make(chan struct{})}
+	}
+	return c
+}
+
+// Attach makes stream the outbound stream for role if it has none yet and
+// starts writing the packets routed to it. It reports whether stream was
+// taken.
+func (c *Conn) Attach(role StreamRole, stream *quic.Stream) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.writers[role]
+	if w.stream != nil {
+		return false
+	}
+	w.stream = stream
+	go c.writeLoop(w)
+	return true
+}
+
+// writer returns the writer for packets with id: the writer of their
+// route once its stream is attached, the control writer otherwise.
+func (c *Conn) writer(id uint32) *streamWriter {
+	role, ok := c.routes[id]
+	if !ok || role == StreamControl {
+		return c.writers[StreamControl]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w := c.writers[role]; w.stream != nil {
+		return w
+	}
+	return c.writers[StreamControl]
+}
+
+// attached returns the writers whose stream is attached, along with the
+// control writer if withControl is set.
+func (c *Conn) attached(withControl bool) []*streamWriter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var writers []*streamWriter
+	for role, w := range c.writers {
+		if w.stream != nil || (withControl && StreamRole(role) == StreamControl) {
+			writers = append(writers, w)
+		}
+	}
+	return writers
+}
+
+// Send encodes packet and queues it for writing, blocking while the queue
+// is full. Encoding errors are returned straight away; write errors close
+// the connection.
+func (c *Conn) Send(packet protocol.Packet) error {
+	return c.SendContext(context.Background(), packet)
+}
+
+// SendContext is Send giving up on a full queue once ctx is done.
+func (c *Conn) SendContext(ctx context.Context, packet protocol.Packet) error {
+	frame, err := AppendPacketFrame(nil, packet, c.maxFrameSize)
+	if err != nil {
+		return err
+	}
+	if info, ok := c.lookup(packet.ID()); ok && info.Unreliable {
+		if sent, err := c.sendDatagram(frame); sent || err != nil {
+			return err
+		}
+	}
+	return c.enqueue(ctx, c.writer(packet.ID()), outbound{frame: frame})
+}
+
+// SupportsDatagrams reports whether both ends enabled QUIC datagrams.
+func (c *Conn) SupportsDatagrams() bool {
+	supports := c.ConnectionState().SupportsDatagrams
+	return supports.Local && supports.Remote
+}
+
+// sendDatagram sends frame as a datagram and reports whether it was. It
+// was not when the client does not take datagrams or frame does not fit,
+// and should be sent on the stream instead.
+func (c *Conn) sendDatagram(frame []byte) (bool, error) {
+	select {
+	case <-c.closing:
+		return false, ErrConnClosed
+	case <-c.closed:
+		return false, ErrConnClosed
+	default:
+	}
+	if !c.SupportsDatagrams() {
+		return false, nil
+	}
+
+	err := c.SendDatagram(frame)
+	var tooLarge *quic.DatagramTooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return false, nil
+	case err != nil:
+		return false, ErrConnClosed
+	}
+	c.metrics.sent(frame)
+	return true, nil
+}
+
+// SendAndWait sends packet and waits for the next packet with responseID
+// the client sends, which is then not handed to the regular handlers.
+func (c *Conn) SendAndWait(ctx context.Context, packet protocol.Packet, responseID uint32) (protocol.Packet, error) {
+	response := make(chan protocol.Packet, 1)
+	c.mu.Lock()
+	c.waiters[responseID] = append(c.waiters[responseID], response)
+	c.mu.Unlock()
+
+	if err := c.Send(packet); err != nil {
+		c.removeWaiter(responseID, response)
+		return nil, err
+	}
+
+	select {
+	case packet := <-response:
+		return packet, nil
+	case <-ctx.Done():
+		c.removeWaiter(responseID, response)
+		return nil, ctx.Err()
+	case <-c.closed:
+		c.removeWaiter(responseID, response)
+		return nil, ErrConnClosed
+	}
+}
+
+// Deliver hands packet to the oldest SendAndWait waiting for its ID and
+// reports whether one was.
+func (c *Conn) Deliver(packet protocol.Packet) bool {
+	c.mu.Lock()
+	waiting := c.waiters[packet.ID()]
+	if len(waiting) == 0 {
+		c.mu.Unlock()
+		return false
+	}
+	response := waiting[0]
+	c.waiters[packet.ID()] = waiting[1:]
+	c.mu.Unlock()
+
+	response <- packet
+	return true
+}
+
+func (c *Conn) removeWaiter(id uint32, response chan protocol.Packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiting := c.waiters[id]
+	for i, ch := range waiting {
+		if ch == response {
+			c.waiters[id] = append(waiting[:i:i], waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flush waits until every packet queued before it has been written, on
+// every stream.
+func (c *Conn) Flush(ctx context.Context) error {
+	for _, w := range c.attached(true) {
+		done := make(chan error, 1)
+		if err := c.enqueue(ctx, w, outbound{done: done}); err != nil {
+			return err
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.done:
+			return ErrConnClosed
+		}
+	}
+	return nil
+}
+
+func (c *Conn) enqueue(ctx context.Context, w *streamWriter, out outbound) error {
+	select {
+	case <-c.closing:
+		return ErrConnClosed
+	case <-c.closed:
+		return ErrConnClosed
+	default:
+	}
+
+	select {
+	case w.queue <- out:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closing:
+		return ErrConnClosed
+	case <-c.closed:
+		return ErrConnClosed
+	case <-c.Context().Done():
+		return ErrConnClosed
+	}
+}
+
+func (c *Conn) writeLoop(w *streamWriter) {
+	defer close(w.done)
+	stream := w.stream
+	for {
+		select {
+		case out := <-w.queue:
+			if !c.write(stream, out) {
+				return
+			}
+		case <-c.closing:
+			// write what is left, then end the stream so the client
+			// knows nothing more follows
+			for {
+				select {
+				case out := <-w.queue:
+					if !c.write(stream, out) {
+						return
+					}
+				default:
+					stream.Close()
+					return
+				}
+			}
+		case <-c.closed:
+			return
+		case <-c.Context().Done():
+			return
+		}
+	}
+}
+
+func (c *Conn) write(stream *quic.Stream, out outbound) bool {
+	if out.frame == nil {
+		out.done <- nil
+		return true
+	}
+	if _, err := stream.Write(out.frame); err != nil {
+		c.CloseWithError(0, "write failed")
+		return false
+	}
+	c.metrics.sent(out.frame)
+	return true
+}
+
+// Close stops accepting packets, writes those already queued and closes
+// the connection with code and reason once the client hung up or ctx is
+// done. Closing the QUIC connection straight away would drop queued data.
+func (c *Conn) Close(ctx context.Context, code quic.ApplicationErrorCode, reason string) error {
+	c.closingOnce.Do(func() { close(c.closing) })
+
+	if writers := c.attached(false); len(writers) > 0 {
+		for _, w := range writers {
+			select {
+			case <-w.done:
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case <-c.Context().Done():
+		case <-ctx.Done():
+		}
+	}
+	return c.CloseWithError(code, reason)
+}
+
+// CloseWithError stops sending, dropping queued packets, and closes the
+// QUIC connection with code and reason. Use Close to deliver them first.
+func (c *Conn) CloseWithError(code quic.ApplicationErrorCode, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.Conn.CloseWithError(code, reason)
+	})
+	return err
+}
@@ -0,0 +1,253 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"hygoal/internal/protocol"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// testPair connects a client to a local listener and returns both ends of
+// the connection along with the stream the client opened.
+func testPair(t *testing.T) (*quic.Conn, *quic.Conn, *quic.Stream) {
+	t.Helper()
+	return testPairWithCert(t, nil)
+}
+
+// testPairWithCert is testPair with the client presenting certs.
+func testPairWithCert(t *testing.T, certs []tls.Certificate) (*quic.Conn, *quic.Conn, *quic.Stream) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	config := Config{ALPN: []string{"hytale/1"}}
+	tlsConf, err := config.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &quic.Transport{Conn: udpConn}
+	t.Cleanup(func() { transport.Close() })
+	listener, err := transport.Listen(tlsConf, config.QUICConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := quic.DialAddr(ctx, udpConn.LocalAddr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"hytale/1"},
+		Certificates:       certs,
+	}, &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.CloseWithError(0, "") })
+
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client, stream
+}
+
+// acceptTestStream makes the client stream visible to the server by
+// sending a packet on it, and attaches it to conn.
+func acceptTestStream(t *testing.T, conn *Conn, stream *quic.Stream) *FrameReader {
+	t.Helper()
+
+	if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	serverStream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conn.Attach(StreamControl, serverStream) {
+		t.Fatal("stream not attached")
+	}
+	if _, err := NewFrameReader(serverStream, 0).ReadFrame(); err != nil {
+		t.Fatal(err)
+	}
+	return NewFrameReader(stream, 0)
+}
+
+func TestConnSend(t *testing.T) {
+	server, _, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	frames := acceptTestStream(t, conn, stream)
+
+	for i := 0; i < 3; i++ {
+		if err := conn.Send(testConnect()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conn.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(packet, testConnect()) {
+			t.Errorf("packet %d = %+v", i, packet)
+		}
+	}
+}
+
+// unreliableLookup looks up the generated packets like protocol.LookupID,
+// with the packet id marked unreliable as the schema has none yet. The
+// registry itself is left alone.
+func unreliableLookup(id uint32) func(uint32) (protocol.PacketInfo, bool) {
+	return func(other uint32) (protocol.PacketInfo, bool) {
+		info, ok := protocol.LookupID(other)
+		info.Unreliable = ok && other == id
+		return info, ok
+	}
+}
+
+func TestConnSendDatagram(t *testing.T) {
+	server, client, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	frames := acceptTestStream(t, conn, stream)
+	disconnect := &protocol.Disconnect{DisconnectType: protocol.CRASH}
+	conn.lookup = unreliableLookup(disconnect.ID())
+
+	if !conn.SupportsDatagrams() {
+		t.Fatal("datagrams not negotiated")
+	}
+	if err := conn.Send(disconnect); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	datagram, err := client.ReceiveDatagram(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := ReadDatagram(datagram, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(packet, disconnect) {
+		t.Errorf("datagram = %+v", packet)
+	}
+
+	// too large for a datagram, it goes on the stream
+	reason := strings.Repeat("x", 2000)
+	if err := conn.Send(&protocol.Disconnect{Reason: &reason}); err != nil {
+		t.Fatal(err)
+	}
+	frame, err = frames.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.ID != disconnect.ID() {
+		t.Errorf("packet %d on the stream", frame.ID)
+	}
+}
+
+func TestConnSendAndWait(t *testing.T) {
+	server, _, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	frames := acceptTestStream(t, conn, stream)
+
+	// the client answers whatever it receives with a Connect of its own
+	go func() {
+		if _, err := frames.ReadFrame(); err != nil {
+			return
+		}
+		reply := testConnect()
+		reply.Username = "Alex"
+		NewFrameWriter(stream, 0).WritePacket(reply)
+	}()
+
+	serverStream := conn.writers[StreamControl].stream
+	go func() {
+		reader := NewFrameReader(serverStream, 0)
+		for {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				return
+			}
+			packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+			if err == nil {
+				conn.Deliver(packet)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := conn.SendAndWait(ctx, testConnect(), testConnect().ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.(*protocol.Connect).Username != "Alex" {
+		t.Errorf("response = %+v", response)
+	}
+}
+
+func TestConnBackpressure(t *testing.T) {
+	server, _, _ := testPair(t)
+	// no stream is attached, so nothing drains the queue
+	conn := NewConn(server, 0, 1)
+	if err := conn.Send(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan error)
+	go func() { sent <- conn.Send(testConnect()) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v with a full queue", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.CloseWithError(0, "")
+	select {
+	case err := <-sent:
+		if !errors.Is(err, ErrConnClosed) {
+			t.Errorf("got %v, want ErrConnClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send still blocked after close")
+	}
+	if err := conn.Send(testConnect()); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("Send after close = %v", err)
+	}
+}
+
+func TestConnSendTooLarge(t *testing.T) {
+	server, _, _ := testPair(t)
+	conn := NewConn(server, 16, 0)
+	if err := conn.Send(testConnect()); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hygoal/internal/protocol"
+	"io"
+)
+
+// FrameHeaderSize is the length and ID prefix of every frame: the payload
+// length as int32 LE, not counting the header, then the packet ID as int32 LE.
+const FrameHeaderSize = 8
+
+// DefaultMaxFrameSize bounds payloads when no other limit is configured.
+const DefaultMaxFrameSize = 1 << 20
+
+var (
+	// ErrFrameTooLarge is returned for frames announcing a payload larger
+	// than the reader or writer allows.
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrMalformedFrame is returned for headers no valid frame can have.
+	ErrMalformedFrame = errors.New("malformed frame")
+)
+
+// Frame is one length-prefixed packet as sent on a stream.
+type Frame struct {
+	ID      uint32
+	Payload []byte
+}
+
+// FrameReader splits a stream into frames. It never allocates more than the
+// announced payload, and refuses announcements above its limits before
+// reading the payload.
+type FrameReader struct {
+	r       io.Reader
+	maxSize int
+	header  [FrameHeaderSize]byte
+
+	// Limit, when set, returns the largest payload allowed for a packet ID,
+	// or an error to refuse the ID. It is called before the payload is read.
+	Limit func(id uint32) (int, error)
+}
+
+// NewFrameReader reads frames from r with payloads of at most maxSize bytes,
+// DefaultMaxFrameSize when maxSize is 0.
+func NewFrameReader(r io.Reader, maxSize int) *FrameReader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameReader{r: r, maxSize: maxSize}
+}
+
+// ReadFrame reads the next frame. It returns io.EOF when the stream ends
+// cleanly between frames and io.ErrUnexpectedEOF when it ends inside one.
+// The payload belongs to the caller.
+func (fr *FrameReader) ReadFrame() (Frame, error) {
+	if _, err := io.ReadFull(fr.r, fr.header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	length := int32(binary.LittleEndian.Uint32(fr.header[:4]))
+	id := binary.LittleEndian.Uint32(fr.header[4:])
+	if length < 0 {
+		return Frame{}, fmt.Errorf("%w: negative length %d for packet %d", ErrMalformedFrame, length, id)
+	}
+
+	limit := fr.maxSize
+	if fr.Limit != nil {
+		packetLimit, err := fr.Limit(id)
+		if err != nil {
+			return Frame{}, err
+		}
+		limit = min(limit, packetLimit)
+	}
+	if int(length) > limit {
+		return Frame{}, fmt.Errorf("%w: packet %d announces %d bytes, max %d", ErrFrameTooLarge, id, length, limit)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(fr.r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+
+	return Frame{ID: id, Payload: payload}, nil
+}
+
+// ReadDatagram reads the frame a QUIC datagram carries. Datagrams use the
+// framing of streams, with exactly one frame each.
+func ReadDatagram(datagram []byte, maxSize int) (Frame, error) {
+	r := bytes.NewReader(datagram)
+	frames := NewFrameReader(r, maxSize)
+	frames.Limit = PacketLimit
+	frame, err := frames.ReadFrame()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Frame{}, fmt.Errorf("%w: datagram of %d bytes is cut short", ErrMalformedFrame, len(datagram))
+	}
+	if err != nil {
+		return Frame{}, err
+	}
+	if r.Len() > 0 {
+		return Frame{}, fmt.Errorf("%w: %d bytes after packet %d in datagram", ErrMalformedFrame, r.Len(), frame.ID)
+	}
+	return frame, nil
+}
+
+// PacketLimit is a FrameReader.Limit that refuses unknown packet IDs and
+// payloads larger than the packet's generated MaxSize.
+func PacketLimit(id uint32) (int, error) {
+	info, ok := protocol.LookupID(id)
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown packet ID %d", ErrMalformedFrame, id)
+	}
+	return info.MaxSize, nil
+}
+
+// FrameWriter writes frames to a stream, each with a single Write so the
+// header and payload cannot be split by other writers. It is not safe for
+// concurrent use.
+type FrameWriter struct {
+	w       io.Writer
+	maxSize int
+	buf     []byte
+}
+
+// NewFrameWriter writes frames to w with payloads of at most maxSize bytes,
+// DefaultMaxFrameSize when maxSize is 0.
+func NewFrameWriter(w io.Writer, maxSize int) *FrameWriter {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameWriter{w: w, maxSize: maxSize}
+}
+
+// WriteFrame writes payload framed with its length and id.
+func (fw *FrameWriter) WriteFrame(id uint32, payload []byte) error {
+	buf := append(fw.buf[:0], make([]byte, FrameHeaderSize)...)
+	buf, err := finishFrame(append(buf, payload...), 0, id, fw.maxSize)
+	if err != nil {
+		return err
+	}
+	fw.buf = buf
+	_, err = fw.w.Write(buf)
+	return err
+}
+
+// WritePacket encodes packet with its generated encoder and writes it as
+// one frame.
+func (fw *FrameWriter) WritePacket(packet protocol.Packet) error {
+	buf, err := AppendPacketFrame(fw.buf[:0], packet, fw.maxSize)
+	if err != nil {
+		return err
+	}
+	fw.buf = buf
+	_, err = fw.w.Write(buf)
+	return err
+}
+
+// AppendPacketFrame appends packet to buf as a complete frame, header
+// included, refusing payloads over maxSize bytes.
+func AppendPacketFrame(buf []byte, packet protocol.Packet, maxSize int) ([]byte, error) {
+	start := len(buf)
+	buf, err := protocol.Encode(append(buf, make([]byte, FrameHeaderSize)...), packet)
+	if err != nil {
+		return nil, err
+	}
+	return finishFrame(buf, start, packet.ID(), maxSize)
+}
+
+// finishFrame fills in the header reserved at buf[start:].
+func finishFrame(buf []byte, start int, id uint32, maxSize int) ([]byte, error) {
+	length := len(buf) - start - FrameHeaderSize
+	if length > maxSize {
+		return nil, fmt.Errorf("%w: packet %d is %d bytes, max %d", ErrFrameTooLarge, id, length, maxSize)
+	}
+
+	binary.LittleEndian.PutUint32(buf[start:], uint32(length))
+	binary.LittleEndian.PutUint32(buf[start+4:], id)
+	return buf, nil
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hygoal/internal/protocol"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+)
+
+func frameBytes(length int32, id uint32, payload []byte) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(length))
+	buf = binary.LittleEndian.AppendUint32(buf, id)
+	return append(buf, payload...)
+}
+
+func testConnect() *protocol.Connect {
+	return &protocol.Connect{
+		ProtocolHash: strings.Repeat("a", 64),
+		ClientType:   protocol.GAME,
+		UUID:         uuid.MustParse("0b8e8a4b-6f1e-4c2a-9d53-5d7ae1d6c3f0"),
+		Username:     "Steve",
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var stream bytes.Buffer
+	writer := NewFrameWriter(&stream, 0)
+	if err := writer.WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFrame(7, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFrame(8, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// deliver the stream a byte at a time so every read comes up short
+	reader := NewFrameReader(iotest.OneByteReader(&stream), 0)
+
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(packet, testConnect()) {
+		t.Errorf("decoded %+v", packet)
+	}
+
+	frame, err = reader.ReadFrame()
+	if err != nil || frame.ID != 7 || !bytes.Equal(frame.Payload, []byte{1, 2, 3}) {
+		t.Errorf("second frame = %+v, %v", frame, err)
+	}
+	frame, err = reader.ReadFrame()
+	if err != nil || frame.ID != 8 || len(frame.Payload) != 0 {
+		t.Errorf("empty frame = %+v, %v", frame, err)
+	}
+
+	if _, err := reader.ReadFrame(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last frame, got %v", err)
+	}
+}
+
+func TestFrameReaderFragmented(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xab}, 4096)
+	data := frameBytes(int32(len(payload)), 3, payload)
+
+	readers := map[string]io.Reader{
+		"one byte":   iotest.OneByteReader(bytes.NewReader(data)),
+		"half":       iotest.HalfReader(bytes.NewReader(data)),
+		"data error": iotest.DataErrReader(bytes.NewReader(data)),
+	}
+	for name, r := range readers {
+		t.Run(name, func(t *testing.T) {
+			frame, err := NewFrameReader(r, 0).ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.ID != 3 || !bytes.Equal(frame.Payload, payload) {
+				t.Errorf("got ID %d and %d bytes", frame.ID, len(frame.Payload))
+			}
+		})
+	}
+}
+
+func TestFrameReaderMalicious(t *testing.T) {
+	connect := protocol.Connect{}
+	tests := []struct {
+		name  string
+		data  []byte
+		limit func(uint32) (int, error)
+		want  error
+	}{
+		{"truncated header", []byte{1, 0, 0}, nil, io.ErrUnexpectedEOF},
+		{"truncated payload", frameBytes(10, 0, []byte{1, 2, 3}), nil, io.ErrUnexpectedEOF},
+		{"header only", frameBytes(10, 0, nil), nil, io.ErrUnexpectedEOF},
+		{"negative length", frameBytes(-1, 0, nil), nil, ErrMalformedFrame},
+		{"huge length", frameBytes(0x7fffffff, 0, nil), nil, ErrFrameTooLarge},
+		{"over max", frameBytes(DefaultMaxFrameSize+1, 0, nil), nil, ErrFrameTooLarge},
+		{"unknown packet", frameBytes(1, 0xdead, []byte{0}), PacketLimit, ErrMalformedFrame},
+		{"over packet max", frameBytes(int32(connect.MaxSize()+1), connect.ID(), nil), PacketLimit, ErrFrameTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewFrameReader(bytes.NewReader(test.data), 0)
+			reader.Limit = test.limit
+			_, err := reader.ReadFrame()
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestReadDatagram(t *testing.T) {
+	connect, err := AppendPacketFrame(nil, testConnect(), DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := ReadDatagram(connect, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.ID != testConnect().ID() || len(frame.Payload) != len(connect)-FrameHeaderSize {
+		t.Errorf("frame = %d with %d bytes", frame.ID, len(frame.Payload))
+	}
+
+	for name, datagram := range map[string][]byte{
+		"empty":          nil,
+		"cut short":      connect[:len(connect)-1],
+		"trailing bytes": append(connect, 0),
+		"unknown packet": frameBytes(1, 0xdead, []byte{0}),
+	} {
+		if _, err := ReadDatagram(datagram, 0); !errors.Is(err, ErrMalformedFrame) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrMalformedFrame)
+		}
+	}
+}
+
+func TestFrameReaderDoesNotReadPastLimit(t *testing.T) {
+	// the announced payload must not be consumed once the frame is refused
+	rest := []byte("untouched")
+	stream := bytes.NewReader(append(frameBytes(64, 1, nil), rest...))
+	if _, err := NewFrameReader(stream, 16).ReadFrame(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got %v", err)
+	}
+	if stream.Len() != len(rest) {
+		t.Errorf("%d bytes left, want %d", stream.Len(), len(rest))
+	}
+}
+
+func TestFrameWriterMaxSize(t *testing.T) {
+	var stream bytes.Buffer
+	writer := NewFrameWriter(&stream, 4)
+	if err := writer.WriteFrame(1, make([]byte, 5)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("got %v", err)
+	}
+	if stream.Len() != 0 {
+		t.Errorf("wrote %d bytes of a refused frame", stream.Len())
+	}
+	if err := writer.WriteFrame(1, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stream.Bytes(), frameBytes(4, 1, make([]byte, 4))) {
+		t.Errorf("wrote %x", stream.Bytes())
+	}
+}
@@ -0,0 +1,101 @@
+package network
+
+import (
+	"hygoal/internal/protocol"
+	"sync"
+	"time"
+)
+
+// maxPendingPings bounds the unanswered pings a session remembers when
+// missing pongs does not kick, the oldest are forgotten first.
+const maxPendingPings = 16
+
+// keepalive tracks the pings sent to a session and the round trip of the
+// pongs it answers with.
+type keepalive struct {
+	mu       sync.Mutex
+	sequence int32
+	// pending holds the unanswered pings, oldest first
+	pending []pendingPing
+	rtt     time.Duration
+}
+
+type pendingPing struct {
+	sequence int32
+	sent     time.Time
+}
+
+// ping records a ping sent now and returns it. Without a limit on missed
+// pongs only the last maxPendingPings pings are remembered, with one the
+// session is disconnected before it has more than that pending.
+func (k *keepalive) ping(now time.Time, limit int) *protocol.Ping {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.sequence++
+	if limit <= 0 && len(k.pending) == maxPendingPings {
+		k.pending = k.pending[1:]
+	}
+	k.pending = append(k.pending, pendingPing{sequence: k.sequence, sent: now})
+	return &protocol.Ping{Sequence: k.sequence, LastRTTMillis: int32(k.rtt.Milliseconds())}
+}
+
+// pong measures the round trip of the ping pong answers and forgets the
+// pings sent before it, their pongs are not waited for anymore. It reports
+// false for pongs to no pending ping, which are ignored.
+func (k *keepalive) pong(pong *protocol.Pong, now time.Time) (time.Duration, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, ping := range k.pending {
+		if ping.sequence == pong.Sequence {
+			k.rtt = now.Sub(ping.sent)
+			k.pending = k.pending[i+1:]
+			return k.rtt, true
+		}
+	}
+	return 0, false
+}
+
+// missed returns the number of pings waiting for a pong.
+func (k *keepalive) missed() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.pending)
+}
+
+// RTT returns the round-trip time of the last ping the client answered, 0
+// before the first pong. It includes the time the client took to answer,
+// unlike SmoothedRTT.
+func (s *Session) RTT() time.Duration {
+	s.keepalive.mu.Lock()
+	defer s.keepalive.mu.Unlock()
+	return s.keepalive.rtt
+}
+
+// SmoothedRTT returns QUIC's estimate of the round-trip time.
+func (s *Session) SmoothedRTT() time.Duration {
+	return s.ConnectionStats().SmoothedRTT
+}
+
+// pingLoop pings session every PingInterval until it disconnects, and
+// disconnects it once MaxMissedPongs pings in a row went unanswered.
+func (s *Server) pingLoop(session *Session) {
+	ticker := time.NewTicker(s.config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-session.Context().Done():
+			return
+		}
+
+		if limit := s.config.MaxMissedPongs; limit > 0 && session.keepalive.missed() >= limit {
+			s.metrics.PingTimeouts.Inc()
+			session.Disconnect("timed out")
+			return
+		}
+		if err := session.SendContext(session.Context(), session.keepalive.ping(time.Now(), s.config.MaxMissedPongs)); err != nil {
+			return
+		}
+		s.metrics.QUICRTT.Observe(session.SmoothedRTT().Seconds())
+	}
+}
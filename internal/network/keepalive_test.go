@@ -0,0 +1,116 @@
+package network
+
+import (
+	"context"
+	"hygoal/internal/auth"
+	"hygoal/internal/protocol"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestKeepalive(t *testing.T) {
+	var k keepalive
+	start := time.Now()
+	first := k.ping(start, 0)
+	second := k.ping(start.Add(time.Second), 0)
+	if first.Sequence == second.Sequence || k.missed() != 2 {
+		t.Fatalf("pings %d and %d, %d missed", first.Sequence, second.Sequence, k.missed())
+	}
+
+	// answering the second ping forgets the first
+	rtt, ok := k.pong(&protocol.Pong{Sequence: second.Sequence}, start.Add(1250*time.Millisecond))
+	if !ok || rtt != 250*time.Millisecond || k.missed() != 0 {
+		t.Fatalf("%d missed, rtt %v", k.missed(), rtt)
+	}
+	if _, ok := k.pong(&protocol.Pong{Sequence: first.Sequence}, start.Add(2*time.Second)); ok || k.rtt != 250*time.Millisecond {
+		t.Errorf("late pong changed rtt to %v", k.rtt)
+	}
+	if ping := k.ping(start, 0); ping.LastRTTMillis != 250 {
+		t.Errorf("LastRTTMillis = %d", ping.LastRTTMillis)
+	}
+
+	for range 2 * maxPendingPings {
+		k.ping(start, 0)
+	}
+	if k.missed() != maxPendingPings {
+		t.Errorf("%d pings pending", k.missed())
+	}
+}
+
+func TestKeepaliveLimitAboveCap(t *testing.T) {
+	var k keepalive
+	limit := maxPendingPings + 4
+	for range limit {
+		k.ping(time.Now(), limit)
+	}
+	if k.missed() != limit {
+		t.Errorf("%d of %d pings pending", k.missed(), limit)
+	}
+}
+
+func TestServerPing(t *testing.T) {
+	server, client, stream := testPair(t)
+	defer client.CloseWithError(0, "")
+	srv := NewServer(Config{Authenticator: auth.Offline{}, PingInterval: 20 * time.Millisecond, MaxMissedPongs: 3})
+	go srv.handleConnection(context.Background(), server)
+
+	writer := NewFrameWriter(stream, 0)
+	if err := writer.WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	frames := NewFrameReader(stream, 0)
+	for pongs := 0; pongs < 3; {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ping, ok := packet.(*protocol.Ping); ok {
+			if err := writer.WritePacket(&protocol.Pong{Sequence: ping.Sequence}); err != nil {
+				t.Fatal(err)
+			}
+			pongs++
+		}
+	}
+
+	session := waitForPhase(t, srv, PhaseSetup)
+	deadline := time.Now().Add(5 * time.Second)
+	for session.RTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no round trip measured")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	players := srv.Players()
+	if len(players) != 1 || players[0].Username != "Steve" || players[0].RTT == 0 || players[0].SmoothedRTT == 0 {
+		t.Errorf("players = %+v", players)
+	}
+}
+
+func TestServerPingTimeout(t *testing.T) {
+	// above maxPendingPings, forgetting old pings would never kick
+	for _, limit := range []int{2, maxPendingPings + 1} {
+		t.Run(strconv.Itoa(limit), func(t *testing.T) {
+			server, client, stream := testPair(t)
+			srv := NewServer(Config{Authenticator: auth.Offline{}, PingInterval: 10 * time.Millisecond, MaxMissedPongs: limit})
+			go srv.handleConnection(context.Background(), server)
+
+			if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+				t.Fatal(err)
+			}
+			// the client reads the pings but never answers them
+			if reason := readDisconnect(t, client, NewFrameReader(stream, 0)); reason != "timed out" {
+				t.Errorf("reason = %q", reason)
+			}
+			if got := testutil.ToFloat64(srv.Metrics().PingTimeouts); got != 1 {
+				t.Errorf("PingTimeouts = %v", got)
+			}
+		})
+	}
+}
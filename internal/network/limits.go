@@ -0,0 +1,192 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Reasons connections are rejected for, the labels of
+// Metrics.HandshakesRejected.
+const (
+	RejectRateLimited     = "rate_limited"
+	RejectUnauthenticated = "unauthenticated_limit"
+	RejectStreamLimit     = "stream_limit"
+)
+
+// DefaultConnectionWindow is the window ConnectionsPerIP counts in when
+// none is configured.
+const DefaultConnectionWindow = time.Minute
+
+// rateLimiter counts connections per IP address in fixed windows.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	clients   map[netip.Addr]*rateWindow
+	lastPrune time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	if window <= 0 {
+		window = DefaultConnectionWindow
+	}
+	return &rateLimiter{limit: limit, window: window, clients: map[netip.Addr]*rateWindow{}}
+}
+
+// Allow counts a connection from addr at now and reports whether it is
+// within the limit.
+func (l *rateLimiter) Allow(addr netip.Addr, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// drop finished windows now and then, so the map does not grow with
+	// every address ever seen
+	if now.Sub(l.lastPrune) >= l.window {
+		for client, window := range l.clients {
+			if now.Sub(window.start) >= l.window {
+				delete(l.clients, client)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	window, ok := l.clients[addr]
+	if !ok || now.Sub(window.start) >= l.window {
+		window = &rateWindow{start: now}
+		l.clients[addr] = window
+	}
+	window.count++
+	return window.count <= l.limit
+}
+
+// remoteIP returns the IP of addr, IPv4-mapped addresses unmapped so both
+// forms count as the same client.
+func remoteIP(addr net.Addr) netip.Addr {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.AddrPort().Addr().Unmap()
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// admission is the slot an unauthenticated connection takes, released once
+// the client authenticated or the connection closed.
+type admission struct {
+	once    sync.Once
+	release func()
+}
+
+func (a *admission) done() {
+	a.once.Do(a.release)
+}
+
+type admissionKey struct{}
+
+// releaseAdmission frees the unauthenticated slot of the connection ctx
+// belongs to, if it took one.
+func releaseAdmission(ctx context.Context) {
+	if a, ok := ctx.Value(admissionKey{}).(*admission); ok {
+		a.done()
+	}
+}
+
+var errRejected = errors.New("connection rejected")
+
+// admit decides whether to accept a connection attempt, before its
+// handshake starts. It is the ConnContext of the server's transports.
+func (s *Server) admit(ctx context.Context, info *quic.ClientInfo) (context.Context, error) {
+	if s.limiter != nil && !s.limiter.Allow(remoteIP(info.RemoteAddr), time.Now()) {
+		return nil, s.reject(info.RemoteAddr, RejectRateLimited)
+	}
+
+	if limit := s.config.MaxUnauthenticated; limit > 0 {
+		if s.unauthenticated.Add(1) > int64(limit) {
+			s.unauthenticated.Add(-1)
+			return nil, s.reject(info.RemoteAddr, RejectUnauthenticated)
+		}
+	} else {
+		s.unauthenticated.Add(1)
+	}
+
+	a := &admission{release: func() { s.unauthenticated.Add(-1) }}
+	context.AfterFunc(ctx, a.done)
+	return context.WithValue(ctx, admissionKey{}, a), nil
+}
+
+// verifySourceAddress asks clients to prove their address with a Retry
+// while many connections are unauthenticated, which makes floods from
+// spoofed addresses cost the server nothing.
+func (s *Server) verifySourceAddress(net.Addr) bool {
+	threshold := s.config.RetryThreshold
+	return threshold > 0 && s.unauthenticated.Load() >= int64(threshold)
+}
+
+// reject counts a rejected connection and logs it, unless recentRejects
+// throttles the log line.
+func (s *Server) reject(addr net.Addr, reason string) error {
+	s.metrics.HandshakesRejected.WithLabelValues(reason).Inc()
+	if s.recentRejects.Add(addr.String(), time.Now()) {
+		s.log.Warn("rejected connection", "remote", addr.String(), "reason", reason)
+	} else {
+		s.metrics.RejectLogsSuppressed.WithLabelValues(reason).Inc()
+	}
+	return errRejected
+}
+
+// rejectWindow is how long a rejected address and port is remembered. A
+// client's first flight can span several Initial packets, each asking for
+// a new connection once the previous one was refused.
+const rejectWindow = time.Second
+
+// maxRecentRejects bounds the remembered addresses during a flood.
+const maxRecentRejects = 4096
+
+// recentRejects remembers the addresses logged as rejected in the last
+// rejectWindow, so each rejected connection attempt is logged once. During
+// a flood of more than maxRecentRejects addresses the rest are not logged
+// until the remembered ones expire.
+type recentRejects struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Add records addr at now and reports whether to log its rejection: it
+// was not logged within the window already and the map has room for it.
+func (r *recentRejects) Add(addr string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if at, ok := r.seen[addr]; ok && now.Sub(at) < rejectWindow {
+		return false
+	}
+	if r.seen == nil {
+		r.seen = map[string]time.Time{}
+	}
+	if len(r.seen) >= maxRecentRejects {
+		for seen, at := range r.seen {
+			if now.Sub(at) >= rejectWindow {
+				delete(r.seen, seen)
+			}
+		}
+		if len(r.seen) >= maxRecentRejects {
+			return false
+		}
+	}
+	r.seen[addr] = now
+	return true
+}
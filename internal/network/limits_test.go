@@ -0,0 +1,218 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"hygoal/internal/auth"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/quic-go/quic-go"
+)
+
+// startServer serves cfg on a free local port until the test ends, and
+// returns the server with the address it listens on.
+func startServer(t *testing.T, cfg Config) (*Server, string) {
+	t.Helper()
+
+	port := freePort(t)
+	cfg.Addresses = []string{"127.0.0.1"}
+	cfg.Port = port
+	cfg.ALPN = []string{"hytale/1"}
+	if cfg.Authenticator == nil {
+		cfg.Authenticator = auth.Offline{}
+	}
+	srv := NewServer(cfg)
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe(ctx) }()
+	t.Cleanup(func() {
+		stop()
+		<-served
+	})
+	return srv, net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+// dialServer connects to addr. Clients retransmit their first packet, so
+// a listener that is not up yet only delays the handshake.
+func dialServer(t *testing.T, addr string) (*quic.Conn, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := quic.DialAddr(ctx, addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"hytale/1"},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { client.CloseWithError(0, "") })
+	return client, nil
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	client, other := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+	now := time.Now()
+
+	if !limiter.Allow(client, now) || !limiter.Allow(client, now.Add(time.Second)) {
+		t.Fatal("connections within the limit refused")
+	}
+	if limiter.Allow(client, now.Add(2*time.Second)) {
+		t.Error("third connection in the window allowed")
+	}
+	if !limiter.Allow(other, now.Add(2*time.Second)) {
+		t.Error("another address was limited too")
+	}
+	if !limiter.Allow(client, now.Add(time.Minute)) {
+		t.Error("still limited in the next window")
+	}
+
+	limiter.Allow(other, now.Add(3*time.Minute))
+	if len(limiter.clients) != 1 {
+		t.Errorf("%d addresses kept, finished windows not pruned", len(limiter.clients))
+	}
+}
+
+func TestReject(t *testing.T) {
+	srv := NewServer(Config{Logger: slog.New(slog.DiscardHandler)})
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5520}
+
+	// every rejection is counted, the same address is logged once
+	srv.reject(addr, RejectRateLimited)
+	srv.reject(addr, RejectRateLimited)
+	m := srv.Metrics()
+	if n := testutil.ToFloat64(m.HandshakesRejected.WithLabelValues(RejectRateLimited)); n != 2 {
+		t.Errorf("%v rejections counted", n)
+	}
+	if n := testutil.ToFloat64(m.RejectLogsSuppressed.WithLabelValues(RejectRateLimited)); n != 1 {
+		t.Errorf("%v log lines suppressed", n)
+	}
+}
+
+func TestRecentRejects(t *testing.T) {
+	var r recentRejects
+	now := time.Now()
+	if !r.Add("192.0.2.1:1", now) || r.Add("192.0.2.1:1", now.Add(rejectWindow/2)) {
+		t.Fatal("address not logged exactly once within the window")
+	}
+	if !r.Add("192.0.2.1:1", now.Add(rejectWindow)) {
+		t.Error("address not logged again after the window")
+	}
+
+	// a flood of ports fills the map, the rest stay quiet until the
+	// remembered ones expire
+	for port := 2; len(r.seen) < maxRecentRejects; port++ {
+		r.Add("192.0.2.1:"+strconv.Itoa(port), now.Add(rejectWindow))
+	}
+	if r.Add("192.0.2.2:1", now.Add(rejectWindow)) {
+		t.Error("logged past maxRecentRejects")
+	}
+	if !r.Add("192.0.2.2:1", now.Add(2*rejectWindow)) {
+		t.Error("not logged once the remembered addresses expired")
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	mapped := &net.UDPAddr{IP: net.ParseIP("::ffff:192.0.2.1"), Port: 5520}
+	if ip := remoteIP(mapped); ip != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("remoteIP(%s) = %s", mapped, ip)
+	}
+}
+
+func TestConnectionsPerIP(t *testing.T) {
+	srv, addr := startServer(t, Config{ConnectionsPerIP: 1})
+
+	first, err := dialServer(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.CloseWithError(0, "")
+
+	if _, err := dialServer(t, addr); err == nil {
+		t.Fatal("second connection within the window accepted")
+	}
+	if n := testutil.ToFloat64(srv.Metrics().HandshakesRejected.WithLabelValues(RejectRateLimited)); n < 1 {
+		t.Errorf("%v rate limited rejections counted", n)
+	}
+}
+
+func TestMaxUnauthenticated(t *testing.T) {
+	srv, addr := startServer(t, Config{MaxUnauthenticated: 1})
+
+	first, err := dialServer(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialServer(t, addr); err == nil {
+		t.Fatal("second unauthenticated connection accepted")
+	}
+	if n := testutil.ToFloat64(srv.Metrics().HandshakesRejected.WithLabelValues(RejectUnauthenticated)); n < 1 {
+		t.Errorf("%v rejections counted", n)
+	}
+
+	// logging in frees the slot
+	stream, err := first.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	waitForPhase(t, srv, PhaseSetup)
+	if n := srv.Unauthenticated(); n != 0 {
+		t.Errorf("%d unauthenticated after login", n)
+	}
+	if _, err := dialServer(t, addr); err != nil {
+		t.Errorf("connection refused after the first logged in: %v", err)
+	}
+}
+
+func TestRetryUnderLoad(t *testing.T) {
+	srv, addr := startServer(t, Config{RetryThreshold: 1})
+	if srv.verifySourceAddress(nil) {
+		t.Error("Retry required without load")
+	}
+
+	if _, err := dialServer(t, addr); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.verifySourceAddress(nil) {
+		t.Error("no Retry required under load")
+	}
+	// clients pass the Retry and connect
+	if _, err := dialServer(t, addr); err != nil {
+		t.Errorf("connection after a Retry failed: %v", err)
+	}
+}
+
+func TestMaxStreams(t *testing.T) {
+	server, client, stream := testPair(t)
+	srv := NewServer(Config{MaxStreams: 1, Authenticator: auth.Offline{}})
+	go srv.handleConnection(context.Background(), server)
+
+	// the first stream ends, so the server accepts the next
+	if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	second, err := client.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Write([]byte{0})
+
+	if reason := readDisconnect(t, client, NewFrameReader(stream, 0)); reason != "too many streams" {
+		t.Errorf("reason = %q", reason)
+	}
+	if n := testutil.ToFloat64(srv.Metrics().HandshakesRejected.WithLabelValues(RejectStreamLimit)); n != 1 {
+		t.Errorf("%v rejections counted", n)
+	}
+}
@@ -0,0 +1,214 @@
+package network
+
+import (
+	"encoding/binary"
+	"hygoal/internal/protocol"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go"
+)
+
+// RejectAuthentication counts clients that failed to authenticate among
+// the rejected handshakes.
+const RejectAuthentication = "authentication_failed"
+
+// RTTBuckets are the upper bounds of the round-trip time histograms, in
+// seconds.
+var RTTBuckets = []float64{.005, .01, .025, .05, .075, .1, .15, .2, .3, .5, 1, 2}
+
+// TickBuckets are the upper bounds of the tick duration histogram, in
+// seconds, around the 50ms a tick has at 20 ticks per second.
+var TickBuckets = []float64{.001, .0025, .005, .01, .025, .05, .075, .1, .25, .5}
+
+// Metrics counts what goes over the server's connections. Nothing is
+// labeled per connection, round trips of single players are in the player
+// list instead.
+type Metrics struct {
+	HandshakesAccepted prometheus.Counter
+	// HandshakesRejected is labeled with the reason.
+	HandshakesRejected *prometheus.CounterVec
+	// RejectLogsSuppressed counts the rejections not logged, by reason,
+	// see recentRejects.
+	RejectLogsSuppressed *prometheus.CounterVec
+
+	// the packet counters are labeled with the packet ID and name
+	PacketsReceived *prometheus.CounterVec
+	BytesReceived   *prometheus.CounterVec
+	PacketsSent     *prometheus.CounterVec
+	BytesSent       *prometheus.CounterVec
+	DecodeErrors    *prometheus.CounterVec
+
+	// PingTimeouts counts the clients disconnected for missing pongs.
+	PingTimeouts prometheus.Counter
+	// PingRTT is observed for every pong, QUICRTT with QUIC's smoothed
+	// round trip of each player every ping interval.
+	PingRTT prometheus.Histogram
+	QUICRTT prometheus.Histogram
+
+	// TickDuration is observed by the game loop through ObserveTick.
+	TickDuration prometheus.Histogram
+}
+
+func newMetrics() *Metrics {
+	packetCounter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, []string{"id", "packet"})
+	}
+	return &Metrics{
+		HandshakesAccepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hygoal_handshakes_accepted_total",
+			Help: "QUIC handshakes completed.",
+		}),
+		HandshakesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hygoal_handshakes_rejected_total",
+			Help: "Connections refused, by reason.",
+		}, []string{"reason"}),
+		RejectLogsSuppressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hygoal_rejection_logs_suppressed_total",
+			Help: "Rejected connections counted but not logged, by reason.",
+		}, []string{"reason"}),
+		PacketsReceived: packetCounter("hygoal_packets_received_total", "Packets received, by packet."),
+		BytesReceived:   packetCounter("hygoal_received_bytes_total", "Bytes of frames received, headers included, by packet."),
+		PacketsSent:     packetCounter("hygoal_packets_sent_total", "Packets sent, by packet."),
+		BytesSent:       packetCounter("hygoal_sent_bytes_total", "Bytes of frames sent, headers included, by packet."),
+		DecodeErrors:    packetCounter("hygoal_decode_errors_total", "Frames that failed to decode, by packet."),
+		PingTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hygoal_ping_timeouts_total",
+			Help: "Clients disconnected for leaving pings unanswered.",
+		}),
+		PingRTT: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "hygoal_ping_rtt_seconds",
+			Help:    "Round-trip time of answered pings.",
+			Buckets: RTTBuckets,
+		}),
+		QUICRTT: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "hygoal_quic_smoothed_rtt_seconds",
+			Help:    "Smoothed QUIC round-trip time of players, sampled every ping interval.",
+			Buckets: RTTBuckets,
+		}),
+		TickDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "hygoal_tick_duration_seconds",
+			Help:    "Time spent per server tick.",
+			Buckets: TickBuckets,
+		}),
+	}
+}
+
+// ObserveTick records the time a server tick took.
+func (m *Metrics) ObserveTick(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.TickDuration.Observe(d.Seconds())
+}
+
+// received counts a frame read from a client.
+func (m *Metrics) received(frame Frame) {
+	if m == nil {
+		return
+	}
+	id, name := packetLabels(frame.ID)
+	m.PacketsReceived.WithLabelValues(id, name).Inc()
+	m.BytesReceived.WithLabelValues(id, name).Add(float64(FrameHeaderSize + len(frame.Payload)))
+}
+
+// sent counts an encoded frame written to a client.
+func (m *Metrics) sent(frame []byte) {
+	if m == nil || len(frame) < FrameHeaderSize {
+		return
+	}
+	id, name := packetLabels(binary.LittleEndian.Uint32(frame[4:]))
+	m.PacketsSent.WithLabelValues(id, name).Inc()
+	m.BytesSent.WithLabelValues(id, name).Add(float64(len(frame)))
+}
+
+func (m *Metrics) decodeError(id uint32) {
+	if m == nil {
+		return
+	}
+	m.DecodeErrors.WithLabelValues(packetLabels(id)).Inc()
+}
+
+func packetLabels(id uint32) (string, string) {
+	return strconv.FormatUint(uint64(id), 10), protocol.PacketName(id)
+}
+
+// quicTotals adds up the QUIC statistics of closed connections, so the
+// totals over all connections never go down.
+type quicTotals struct {
+	packetsSent uint64
+	packetsLost uint64
+}
+
+func (t *quicTotals) add(stats quic.ConnectionStats) {
+	t.packetsSent += stats.PacketsSent
+	t.packetsLost += stats.PacketsLost
+}
+
+// Metrics returns the server's counters.
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+// RegisterMetrics exposes the server's metrics on r, QUIC statistics
+// summed over every connection included.
+func (s *Server) RegisterMetrics(r prometheus.Registerer) {
+	m := s.metrics
+	r.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "hygoal_connections",
+			Help: "Open connections, in any phase.",
+		}, func() float64 {
+			return float64(len(s.Sessions()))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "hygoal_players",
+			Help: "Authenticated players, in setup or in the world.",
+		}, func() float64 {
+			return float64(len(s.Players()))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "hygoal_unauthenticated_connections",
+			Help: "Connections handshaking or logging in.",
+		}, func() float64 {
+			return float64(s.Unauthenticated())
+		}),
+		m.HandshakesAccepted,
+		m.HandshakesRejected,
+		m.RejectLogsSuppressed,
+		m.PacketsReceived,
+		m.BytesReceived,
+		m.PacketsSent,
+		m.BytesSent,
+		m.DecodeErrors,
+		m.PingTimeouts,
+		m.PingRTT,
+		m.QUICRTT,
+		m.TickDuration,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "hygoal_quic_packets_sent_total",
+			Help: "QUIC packets sent over all connections.",
+		}, func() float64 {
+			return float64(s.quicTotals().packetsSent)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "hygoal_quic_packets_lost_total",
+			Help: "QUIC packets declared lost over all connections.",
+		}, func() float64 {
+			return float64(s.quicTotals().packetsLost)
+		}),
+	)
+}
+
+// quicTotals returns the QUIC statistics of the closed connections plus
+// those of the open ones.
+func (s *Server) quicTotals() quicTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totals := s.closedQUIC
+	for session := range s.sessions {
+		totals.add(session.ConnectionStats())
+	}
+	return totals
+}
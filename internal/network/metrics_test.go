@@ -0,0 +1,147 @@
+package network
+
+import (
+	"context"
+	"hygoal/internal/auth"
+	"hygoal/internal/protocol"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestServerDatagrams(t *testing.T) {
+	server, client, _ := testPair(t)
+	defer client.CloseWithError(0, "")
+	srv := NewServer(Config{Authenticator: auth.Offline{}})
+	srv.lookup = unreliableLookup(testConnect().ID())
+	go srv.handleConnection(context.Background(), server)
+
+	// reliable packets sent as datagrams are dropped
+	disconnect, err := AppendPacketFrame(nil, &protocol.Disconnect{}, DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect, err := AppendPacketFrame(nil, testConnect(), DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendDatagram(disconnect); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendDatagram(connect); err != nil {
+		t.Fatal(err)
+	}
+
+	session := waitForPhase(t, srv, PhaseSetup)
+	if session.Username != "Steve" {
+		t.Errorf("logged in as %q", session.Username)
+	}
+	if n := testutil.ToFloat64(srv.Metrics().PacketsReceived.WithLabelValues("1", "Disconnect")); n != 1 {
+		t.Errorf("%v Disconnect datagrams counted", n)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	server, client, stream := testPair(t)
+	defer client.CloseWithError(0, "")
+	srv := NewServer(Config{Authenticator: auth.Offline{}, PingInterval: 20 * time.Millisecond})
+	go srv.handleConnection(context.Background(), server)
+
+	connect, err := AppendPacketFrame(nil, testConnect(), DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Write(connect); err != nil {
+		t.Fatal(err)
+	}
+	session := waitForPhase(t, srv, PhaseSetup)
+	if err := session.Send(&protocol.Disconnect{DisconnectType: protocol.DISCONNECT}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// answer a ping, so both round trips are observed
+	frames := NewFrameReader(stream, 0)
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.ID == (&protocol.Ping{}).ID() {
+			ping, err := protocol.DecodeByID(frame.ID, frame.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := NewFrameWriter(stream, 0).WritePacket(&protocol.Pong{Sequence: ping.(*protocol.Ping).Sequence}); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for session.RTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no round trip measured")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srv.Metrics().ObserveTick(30 * time.Millisecond)
+	r := prometheus.NewPedanticRegistry()
+	srv.RegisterMetrics(r)
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := map[string]*dto.MetricFamily{}
+	for _, family := range families {
+		gathered[family.GetName()] = family
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "conn" || label.GetName() == "username" {
+					t.Errorf("%s is labeled per connection", family.GetName())
+				}
+			}
+		}
+	}
+	for name, want := range map[string]float64{
+		"hygoal_connections":                 1,
+		"hygoal_players":                     1,
+		"hygoal_unauthenticated_connections": 0,
+	} {
+		if family := gathered[name]; family == nil || family.GetMetric()[0].GetGauge().GetValue() != want {
+			t.Errorf("%s = %v, want %v", name, family, want)
+		}
+	}
+	m := srv.Metrics()
+	if n := testutil.ToFloat64(m.HandshakesAccepted); n != 1 {
+		t.Errorf("%v handshakes accepted", n)
+	}
+	if n := testutil.ToFloat64(m.PacketsReceived.WithLabelValues("0", "Connect")); n != 1 {
+		t.Errorf("%v Connect packets counted", n)
+	}
+	if n := testutil.ToFloat64(m.BytesReceived.WithLabelValues("0", "Connect")); n != float64(len(connect)) {
+		t.Errorf("%v Connect bytes counted", n)
+	}
+	if n := testutil.ToFloat64(m.PacketsSent.WithLabelValues("1", "Disconnect")); n != 1 {
+		t.Errorf("%v Disconnect packets counted", n)
+	}
+
+	for _, name := range []string{"hygoal_ping_rtt_seconds", "hygoal_quic_smoothed_rtt_seconds", "hygoal_tick_duration_seconds"} {
+		if family := gathered[name]; family == nil || family.GetMetric()[0].GetHistogram().GetSampleCount() == 0 {
+			t.Errorf("%s not observed", name)
+		}
+	}
+	for _, name := range []string{"hygoal_quic_packets_sent_total", "hygoal_quic_packets_lost_total"} {
+		if family := gathered[name]; family == nil || family.GetType() != dto.MetricType_COUNTER {
+			t.Errorf("%s is not a counter", name)
+		}
+	}
+	if sent := gathered["hygoal_quic_packets_sent_total"].GetMetric()[0].GetCounter().GetValue(); sent == 0 {
+		t.Error("no QUIC packets counted")
+	}
+}
@@ -1,69 +1,262 @@
 package network
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
 	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
+// selfSignedValidity is how long generated certificates are valid. They
+// are persisted, so clients pinning them keep working across restarts.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// certCheckInterval throttles how often GetCertificate looks for changed
+// certificate files.
+const certCheckInterval = 5 * time.Second
+
+// NewSelfSignedServerCert generates an in-memory ECDSA certificate valid for
+// hosts, which may be DNS names or IP addresses.
 func NewSelfSignedServerCert(hosts ...string) (tls.Certificate, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	certPEM, keyPEM, err := generateSelfSignedCert(hosts)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func generateSelfSignedCert(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serial, err := rand.Int(rand.Reader, serialLimit)
 	if err != nil {
-		return tls.Certificate{}, err
+		return nil, nil, err
 	}
 
 	tmpl := &x509.Certificate{
 		SerialNumber: serial,
 		Subject: pkix.Name{
-			//CommonName:   "localhost",
 			Organization: []string{"Hygoal Self-Signed"},
 		},
 		NotBefore:             time.Now().Add(-1 * time.Hour), // helps clock skew
-		NotAfter:              time.Now().Add(30 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
 		KeyUsage:              x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if h != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	if len(tmpl.DNSNames) > 0 {
+		tmpl.Subject.CommonName = tmpl.DNSNames[0]
+	}
 
-		//DNSNames:    []string{},
-		//IPAddresses: []net.IP{},
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	//tmpl.DNSNames = append(tmpl.DNSNames, "localhost")
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
 
-	//for _, h := range hosts {
-	//	if ip := net.ParseIP(h); ip != nil {
-	//		tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
-	//	} else if h != "" {
-	//		tmpl.DNSNames = append(tmpl.DNSNames, h)
-	//	}
-	//}
+// EnsureSelfSignedCert generates a certificate for hosts at certFile and
+// keyFile, unless a certificate for the same hosts that has not expired is
+// already there. It reports whether a new one was written.
+func EnsureSelfSignedCert(certFile, keyFile string, hosts []string) (bool, error) {
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if time.Now().Before(cert.Leaf.NotAfter) && certHostsMatch(cert.Leaf, hosts) {
+			return false, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
 
-	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	certPEM, keyPEM, err := generateSelfSignedCert(hosts)
 	if err != nil {
-		return tls.Certificate{}, err
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return false, err
+	}
+	// the key first, so a certificate is never left without its key
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return false, err
 	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+// certHostsMatch reports whether cert was issued for exactly hosts.
+func certHostsMatch(cert *x509.Certificate, hosts []string) bool {
+	want := map[string]bool{}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			want[ip.String()] = true
+		} else if h != "" {
+			want[h] = true
+		}
+	}
+	have := map[string]bool{}
+	for _, name := range cert.DNSNames {
+		have[name] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		have[ip.String()] = true
+	}
+	return maps.Equal(want, have)
+}
 
-	return tls.X509KeyPair(certPEM, keyPEM)
+// Fingerprint returns the SHA-256 of cert in the colon separated hex form
+// clients show for pinning.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// CertReloader serves a certificate loaded from disk through
+// tls.Config.GetCertificate, picking up replaced files without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewCertReloader loads the certificate and key at certFile and keyFile,
+// logging reloads to logger, or slog.Default when nil.
+func NewCertReloader(certFile, keyFile string, logger *slog.Logger) (*CertReloader, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Certificate returns the certificate currently served.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate. It reloads the
+// files when they changed since the last load, keeping the previous
+// certificate if the new files are not valid.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	check := time.Since(r.lastCheck) >= certCheckInterval
+	if check {
+		r.lastCheck = time.Now()
+	}
+	r.mu.Unlock()
+
+	if check && r.changed() {
+		if err := r.load(); err != nil {
+			r.logger.Error("reloading TLS certificate failed, keeping the current one", "file", r.certFile, "err", err)
+		}
+	}
+	return r.Certificate(), nil
+}
+
+func (r *CertReloader) changed() bool {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !modTime.Equal(r.modTime)
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *CertReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+
+	r.logger.Info("loaded TLS certificate", "file", r.certFile, "fingerprint", Fingerprint(cert.Leaf))
+	return nil
 }
 
-func NewQUICServerTLSConfig(cert tls.Certificate) *tls.Config {
+// NewQUICServerTLSConfig returns TLS 1.3 settings serving the certificates
+// getCertificate returns. Client certificates are requested but not
+// verified, clients use self-signed ones their identity token is bound to.
+func NewQUICServerTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
 	return &tls.Config{
-		MinVersion:   tls.VersionTLS13,
-		Certificates: []tls.Certificate{cert},
+		MinVersion:     tls.VersionTLS13,
+		GetCertificate: getCertificate,
+		ClientAuth:     tls.RequestClientCert,
 
 		NextProtos: []string{"hytale/1"},
 	}
@@ -0,0 +1,145 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedServerCert(t *testing.T) {
+	cert, err := NewSelfSignedServerCert("localhost", "play.example.com", "127.0.0.1", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cert.PrivateKey.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("key is %T, want ECDSA", cert.PrivateKey)
+	}
+	if len(cert.Leaf.DNSNames) != 2 || len(cert.Leaf.IPAddresses) != 2 {
+		t.Errorf("SANs = %v %v", cert.Leaf.DNSNames, cert.Leaf.IPAddresses)
+	}
+	if err := cert.Leaf.VerifyHostname("play.example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls", "cert.pem"), filepath.Join(dir, "tls", "key.pem")
+
+	generated, err := EnsureSelfSignedCert(certFile, keyFile, []string{"localhost"})
+	if err != nil || !generated {
+		t.Fatalf("generated = %v, %v", generated, err)
+	}
+	first, err := NewCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart keeps the certificate clients may have pinned
+	generated, err = EnsureSelfSignedCert(certFile, keyFile, []string{"localhost"})
+	if err != nil || generated {
+		t.Fatalf("generated = %v, %v", generated, err)
+	}
+	second, err := NewCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Fingerprint(first.Certificate().Leaf) != Fingerprint(second.Certificate().Leaf) {
+		t.Error("certificate replaced on restart")
+	}
+
+	// new hosts need a new certificate, the order they are given in does
+	// not
+	hosts := []string{"play.example.com", "127.0.0.1"}
+	generated, err = EnsureSelfSignedCert(certFile, keyFile, hosts)
+	if err != nil || !generated {
+		t.Fatalf("generated = %v, %v after the hosts changed", generated, err)
+	}
+	generated, err = EnsureSelfSignedCert(certFile, keyFile, []string{"127.0.0.1", "play.example.com"})
+	if err != nil || generated {
+		t.Fatalf("generated = %v, %v with the same hosts", generated, err)
+	}
+	third, err := NewCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf := third.Certificate().Leaf; leaf.VerifyHostname("play.example.com") != nil || leaf.VerifyHostname("127.0.0.1") != nil {
+		t.Errorf("certificate issued for %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key mode = %v", info.Mode().Perm())
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert := func(hosts ...string) {
+		certPEM, keyPEM, err := generateSelfSignedCert(hosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(certFile, certPEM, 0644)
+		os.WriteFile(keyFile, keyPEM, 0600)
+		// make the change visible whatever the file system's time resolution
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, later, later)
+	}
+
+	writeCert("old.example.com")
+	reloader, err := NewCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert("new.example.com")
+	// changes are only looked for every certCheckInterval
+	cert, _ := reloader.GetCertificate(nil)
+	if cert.Leaf.DNSNames[0] != "old.example.com" {
+		t.Errorf("reloaded before the check interval: %v", cert.Leaf.DNSNames)
+	}
+	reloader.lastCheck = time.Time{}
+	cert, _ = reloader.GetCertificate(nil)
+	if cert.Leaf.DNSNames[0] != "new.example.com" {
+		t.Errorf("not reloaded: %v", cert.Leaf.DNSNames)
+	}
+
+	// a broken replacement keeps the working certificate
+	os.WriteFile(certFile, []byte("not a certificate"), 0644)
+	later := time.Now().Add(2 * time.Minute)
+	os.Chtimes(certFile, later, later)
+	reloader.lastCheck = time.Time{}
+	cert, err = reloader.GetCertificate(nil)
+	if err != nil || cert.Leaf.DNSNames[0] != "new.example.com" {
+		t.Errorf("got %v, %v", cert.Leaf.DNSNames, err)
+	}
+}
+
+func TestTLSConfigDataDir(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{ALPN: []string{"hytale/1"}, DataDir: dir, CertHosts: []string{"example.com"}}
+	tlsConf, err := config.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tlsConf.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.DNSNames[0] != "example.com" {
+		t.Errorf("SANs = %v", cert.Leaf.DNSNames)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cert.pem")); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,119 +1,497 @@
 package network
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"hygoal/internal/auth"
+	"hygoal/internal/logging"
 	"hygoal/internal/protocol"
-	"log"
+	"io"
+	"log/slog"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/quic-go/quic-go"
 )
 
-func StartQuicServer() error {
-	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{
-		Port: 5520,
-		IP:   net.ParseIP("0.0.0.0"),
-	})
-	if err != nil {
-		return err
+var errNoAuthenticator = errors.New("no authenticator configured")
+
+// inboundQueueSize is the number of received packets a connection buffers
+// for its handlers before its readers wait.
+const inboundQueueSize = 64
+
+// ShutdownReason is the disconnect reason players see when the server
+// stops.
+const ShutdownReason = "Server shutting down"
+
+// Server accepts QUIC connections and runs each through its session
+// phases.
+type Server struct {
+	config   Config
+	handlers *Handlers
+
+	mu       sync.Mutex
+	sessions map[*Session]struct{}
+	// stopping is set once shutdown took its snapshot of sessions, the
+	// connections registering later are disconnected straight away
+	stopping bool
+	// closedQUIC sums the QUIC statistics of the connections that closed
+	closedQUIC quicTotals
+	onStop     []func(ctx context.Context) error
+	// conns tracks the connection goroutines, so shutdown can wait for them
+	conns sync.WaitGroup
+
+	log    *slog.Logger
+	connID atomic.Uint64
+
+	limiter *rateLimiter
+	// unauthenticated counts the connections admitted that have not
+	// authenticated yet, the handshake included
+	unauthenticated atomic.Int64
+	recentRejects   recentRejects
+
+	metrics *Metrics
+	// lookup is handed to every connection, see Conn.lookup
+	lookup func(id uint32) (protocol.PacketInfo, bool)
+}
+
+// NewServer returns a server for cfg with the login flow registered.
+func NewServer(cfg Config) *Server {
+	s := &Server{
+		config:   cfg,
+		handlers: NewHandlers(),
+		sessions: map[*Session]struct{}{},
+		log:      cfg.logger(logging.Network),
+		metrics:  newMetrics(),
+		lookup:   protocol.LookupID,
+	}
+	if cfg.ConnectionsPerIP > 0 {
+		s.limiter = newRateLimiter(cfg.ConnectionsPerIP, cfg.ConnectionWindow)
+	}
+	HandlePacket(s.handlers, PhaseConnect, s.handleConnect)
+	return s
+}
+
+// Handlers returns the packet handlers, for registering more before the
+// server starts.
+func (s *Server) Handlers() *Handlers {
+	return s.handlers
+}
+
+// OnShutdown registers fn to run during shutdown, after every player was
+// disconnected and before the listeners close, to save state. Its context
+// ends at the shutdown deadline.
+func (s *Server) OnShutdown(fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStop = append(s.onStop, fn)
+}
+
+// Sessions returns the connected sessions.
+func (s *Server) Sessions() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
 	}
-	fmt.Println("QUIC server listening on port 5520")
+	return sessions
+}
 
-	transport := quic.Transport{
-		Conn: udpConn,
+// Player is an entry of the player list.
+type Player struct {
+	Username string
+	UUID     uuid.UUID
+	// RTT is the round trip of the last ping the player answered,
+	// SmoothedRTT QUIC's estimate.
+	RTT         time.Duration
+	SmoothedRTT time.Duration
+}
+
+// Players returns the authenticated players still connected, in setup or
+// in the world.
+func (s *Server) Players() []Player {
+	var players []Player
+	for _, session := range s.Sessions() {
+		if phase := session.Phase(); phase != PhaseSetup && phase != PhasePlay {
+			continue
+		}
+		session.mu.Lock()
+		player := Player{Username: session.Username, UUID: session.UUID}
+		session.mu.Unlock()
+		player.RTT = session.RTT()
+		player.SmoothedRTT = session.SmoothedRTT()
+		players = append(players, player)
 	}
+	return players
+}
+
+// Unauthenticated returns the number of connections that have not
+// authenticated yet.
+func (s *Server) Unauthenticated() int64 {
+	return s.unauthenticated.Load()
+}
+
+// StartQuicServer listens on every address in cfg and serves connections
+// until ctx is done.
+func StartQuicServer(ctx context.Context, cfg Config) error {
+	return NewServer(cfg).ListenAndServe(ctx)
+}
 
-	cert, err := NewSelfSignedServerCert("localhost")
+// ListenAndServe listens on every configured address and serves
+// connections until ctx is done or a listener fails, then shuts down
+// gracefully. It returns nil after a shutdown caused by ctx.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.config.Authenticator == nil {
+		return errNoAuthenticator
+	}
+	addrs, err := s.config.ListenAddrs()
 	if err != nil {
-		log.Fatalf("generating self-signed cert: %v", err)
+		return err
 	}
 
-	tlsConf := NewQUICServerTLSConfig(cert)
-
-	listener, err := transport.Listen(tlsConf, nil)
+	tlsConf, err := s.config.TLSConfig()
 	if err != nil {
 		return err
 	}
+	quicConf := s.config.QUICConfig()
 
-	fmt.Println("QUIC server accepting connections...")
+	// connections outlive ctx until they were disconnected properly
+	connCtx, cancelConns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelConns()
 
+	var transports []*quic.Transport
+	closeTransports := func() {
+		for _, transport := range transports {
+			transport.Close()
+		}
+	}
+
+	errs := make(chan error, len(addrs))
+	var listeners []*quic.Listener
+	for _, addr := range addrs {
+		udpConn, err := net.ListenUDP(s.config.network(), addr)
+		if err != nil {
+			closeTransports()
+			return err
+		}
+
+		transport := &quic.Transport{
+			Conn:                udpConn,
+			ConnContext:         s.admit,
+			VerifySourceAddress: s.verifySourceAddress,
+		}
+		transports = append(transports, transport)
+
+		listener, err := transport.Listen(tlsConf, quicConf)
+		if err != nil {
+			closeTransports()
+			return err
+		}
+		listeners = append(listeners, listener)
+		s.log.Info("QUIC server listening", "addr", udpConn.LocalAddr().String())
+
+		go func() {
+			errs <- s.acceptConnections(connCtx, listener)
+		}()
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errs:
+	}
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	err = s.shutdown()
+	cancelConns()
+	closeTransports()
+	return errors.Join(serveErr, err)
+}
+
+// shutdown disconnects every player and runs the OnShutdown hooks within
+// the configured deadline.
+func (s *Server) shutdown() error {
+	timeout := s.config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	s.mu.Lock()
+	s.stopping = true
+	sessions := make([]*Session, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+	s.log.Info("shutting down", "connections", len(sessions))
+
+	var disconnects sync.WaitGroup
+	for _, session := range sessions {
+		disconnects.Go(func() {
+			session.DisconnectContext(ctx, ShutdownReason)
+		})
+	}
+	disconnects.Wait()
+
+	s.mu.Lock()
+	hooks := s.onStop
+	s.mu.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		errs = append(errs, hook(ctx))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("shutdown deadline exceeded: %w", ctx.Err()))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) acceptConnections(ctx context.Context, listener *quic.Listener) error {
 	for {
-		conn, err := listener.Accept(context.Background())
+		conn, err := listener.Accept(ctx)
 		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) || ctx.Err() != nil {
+				return err
+			}
 			if conn != nil {
 				conn.CloseWithError(0, "error accepting connection")
 			}
 			continue
 		}
 
-		go handleConnection(conn)
+		s.conns.Go(func() {
+			s.handleConnection(ctx, conn)
+		})
 	}
 }
 
-func handleConnection(conn *quic.Conn) {
-	fmt.Println("New connection accepted")
+func (s *Server) handleConnection(ctx context.Context, quicConn *quic.Conn) {
+	id := s.connID.Add(1)
+	logger := s.config.logger(logging.Conn).With("conn", id, "remote", quicConn.RemoteAddr().String())
+	conn := NewConn(quicConn, s.config.MaxFrameSize, s.config.SendQueueSize)
+	conn.metrics = s.metrics
+	conn.routes = s.config.StreamRoutes
+	conn.lookup = s.lookup
+	session := NewSession(conn, s.handlers, s.config.PhaseTimeouts, logger)
+	session.ID = id
+	session.Logger().Info("connection accepted")
+	defer session.Closed()
+
+	s.mu.Lock()
+	s.sessions[session] = struct{}{}
+	stopping := s.stopping
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.closedQUIC.add(session.ConnectionStats())
+		delete(s.sessions, session)
+		s.mu.Unlock()
+	}()
+	// accepted before shutdown but registered too late for it
+	if stopping {
+		session.Disconnect(ShutdownReason)
+		return
+	}
+
+	select {
+	case <-quicConn.HandshakeComplete():
+	case <-quicConn.Context().Done():
+		return
+	case <-ctx.Done():
+		session.CloseWithError(0, ShutdownReason)
+		return
+	}
+	s.metrics.HandshakesAccepted.Inc()
+	session.SetPhase(PhaseConnect)
+
+	inbound := make(chan protocol.Packet, inboundQueueSize)
+	var readers sync.WaitGroup
+	defer readers.Wait()
+	if session.SupportsDatagrams() {
+		readers.Go(func() { s.readDatagrams(session, inbound) })
+	}
+	readers.Go(func() { s.acceptStreams(ctx, session, inbound, &readers) })
+	s.dispatch(session, inbound)
+}
+
+// acceptStreams starts a reader for every stream the client opens and
+// attaches the streams with a role for sending, until the connection
+// closes.
+func (s *Server) acceptStreams(ctx context.Context, session *Session, inbound chan<- protocol.Packet, readers *sync.WaitGroup) {
+	streams := 0
 	for {
-		stream, err := conn.AcceptStream(context.Background())
+		stream, err := session.AcceptStream(ctx)
 		if err != nil {
-			conn.CloseWithError(0, "error accepting stream")
+			session.CloseWithError(0, "error accepting stream")
+			return
+		}
+		streams++
+		if limit := s.config.MaxStreams; limit > 0 && streams > limit {
+			s.reject(session.RemoteAddr(), RejectStreamLimit)
+			session.Disconnect("too many streams")
 			return
 		}
 
-		for {
-			// packet length
-			var packetLen uint32
-			lenBuf := make([]byte, 4)
-			_, err = stream.Read(lenBuf)
-			if err != nil {
-				break
-			}
-			lenReader := bytes.NewReader(lenBuf)
-			err = binary.Read(lenReader, binary.LittleEndian, &packetLen)
-			if err != nil {
-				log.Printf("error reading packet length: %v", err)
-				break
-			}
+		if role, ok := streamRole(stream.StreamID()); ok {
+			session.Attach(role, stream)
+			session.Logger().Debug("stream opened", "stream", int64(stream.StreamID()), "role", role.String())
+		} else {
+			session.Logger().Debug("stream opened", "stream", int64(stream.StreamID()))
+		}
+		readers.Go(func() { s.readStream(session, stream, inbound) })
+	}
+}
 
-			// packet data
-			packetData := make([]byte, packetLen+4)
-			_, err = stream.Read(packetData)
-			if err != nil {
-				log.Printf("error reading packet data: %v", err)
-				break
+// readStream queues the packets the client sends on stream until the
+// stream ends.
+func (s *Server) readStream(session *Session, stream *quic.Stream, inbound chan<- protocol.Packet) {
+	frames := NewFrameReader(stream, s.config.MaxFrameSize)
+	frames.Limit = PacketLimit
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && session.Phase() != PhaseDisconnected && session.Context().Err() == nil {
+				session.Logger().Warn("reading frame failed", "err", err)
+				session.Disconnect("malformed frame")
 			}
+			return
+		}
+		s.metrics.received(frame)
+		if !s.receive(session, frame, inbound) {
+			return
+		}
+	}
+}
 
-			// decode packet ID
-			var packetID uint32
-			idBuf := bytes.NewReader(packetData[:4])
-			err = binary.Read(idBuf, binary.LittleEndian, &packetID)
-			if err != nil {
-				log.Printf("error reading packet ID: %v", err)
-				continue
-			}
+// readDatagrams queues the packets the client sends in datagrams until
+// the connection closes. Only packets marked unreliable may come that way,
+// others are dropped: they could overtake the stream they belong on.
+func (s *Server) readDatagrams(session *Session, inbound chan<- protocol.Packet) {
+	for {
+		datagram, err := session.ReceiveDatagram(session.Context())
+		if err != nil {
+			return
+		}
+		frame, err := ReadDatagram(datagram, s.config.MaxFrameSize)
+		if err != nil {
+			session.Logger().Warn("reading datagram failed", "err", err)
+			session.Disconnect("malformed datagram")
+			return
+		}
+		s.metrics.received(frame)
+		if info, _ := session.lookup(frame.ID); !info.Unreliable {
+			session.Logger().Debug("dropped reliable packet sent in a datagram", "id", frame.ID, "packet", protocol.PacketName(frame.ID))
+			continue
+		}
+		if !s.receive(session, frame, inbound) {
+			return
+		}
+	}
+}
 
-			packet, err := protocol.DecodeByID(packetID, packetData[4:])
-			if err != nil {
-				log.Printf("error decoding packet ID %d: %v", packetID, err)
-				continue
-			}
+// receive decodes frame and queues the packet for the handlers, unless a
+// SendAndWait takes it. It reports whether the connection is still open;
+// malformed packets disconnect the client.
+func (s *Server) receive(session *Session, frame Frame, inbound chan<- protocol.Packet) bool {
+	packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+	if err != nil {
+		s.metrics.decodeError(frame.ID)
+		session.Logger().Warn("decoding packet failed", "id", frame.ID, "packet", protocol.PacketName(frame.ID), "err", err)
+		session.Disconnect("malformed " + protocol.PacketName(frame.ID) + " packet")
+		return false
+	}
+	if pong, ok := packet.(*protocol.Pong); ok {
+		if rtt, ok := session.keepalive.pong(pong, time.Now()); ok {
+			s.metrics.PingRTT.Observe(rtt.Seconds())
+		}
+		return true
+	}
+	// responses are taken straight away, the handler waiting for one
+	// holds up the queue
+	if session.Deliver(packet) {
+		return true
+	}
+	select {
+	case inbound <- packet:
+		return true
+	case <-session.Context().Done():
+		return false
+	}
+}
 
-			log.Printf("Received packet ith ID %d: %+v", packetID, packet)
+// dispatch hands the queued packets to the handlers one at a time, in the
+// order they arrived, until the connection closes.
+func (s *Server) dispatch(session *Session, inbound <-chan protocol.Packet) {
+	for {
+		select {
+		case packet := <-inbound:
+			if err := session.Handle(packet); err != nil {
+				return
+			}
+		case <-session.Context().Done():
+			return
 		}
+	}
+}
 
-		//err = debug_writeStream(stream)
-		//if err != nil {
-		//	log.Printf("error handling stream: %v", err)
-		//}
+// handleConnect authenticates the client and moves it on to setup.
+func (s *Server) handleConnect(session *Session, packet *protocol.Connect) error {
+	session.Logger().Info("connecting", "claimed_username", packet.Username, "claimed_uuid", packet.UUID.String())
+	if err := session.SetPhase(PhaseAuthentication); err != nil {
+		return err
+	}
+	if s.config.Authenticator == nil {
+		return errNoAuthenticator
+	}
 
-		stream.Close()
+	request := auth.Request{
+		Username:    packet.Username,
+		UUID:        packet.UUID,
+		Certificate: session.PeerCertificate(),
 	}
+	if packet.IdentityToken != nil {
+		request.IdentityToken = *packet.IdentityToken
+	}
+	identity, err := s.config.Authenticator.Authenticate(session.Context(), request)
+	if err != nil {
+		session.Logger().Warn("authentication failed", "claimed_username", packet.Username, "claimed_uuid", packet.UUID.String(), "err", err)
+		s.metrics.HandshakesRejected.WithLabelValues(RejectAuthentication).Inc()
+		return err
+	}
+
+	session.SetIdentity(identity.Username, identity.UUID)
+	session.Logger().Info("authenticated")
+	releaseAdmission(session.Context())
+	if err := session.SetPhase(PhaseSetup); err != nil {
+		return err
+	}
+	if s.config.PingInterval > 0 {
+		s.conns.Go(func() { s.pingLoop(session) })
+	}
+	return nil
 }
 
-func debug_writeStream(stream quic.Stream) error {
+func debug_writeStream(stream *quic.Stream) error {
 	buf := make([]byte, 1024)
 	n, err := stream.Read(buf)
 	if err != nil {
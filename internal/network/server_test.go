@@ -0,0 +1,136 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"hygoal/internal/auth"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// freePort returns a UDP port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestServerShutdown(t *testing.T) {
+	port := freePort(t)
+	srv := NewServer(Config{
+		Addresses:       []string{"127.0.0.1"},
+		Port:            port,
+		ALPN:            []string{"hytale/1"},
+		ShutdownTimeout: 5 * time.Second,
+		Authenticator:   auth.Offline{},
+	})
+	saved := false
+	srv.OnShutdown(func(ctx context.Context) error {
+		for _, session := range srv.Sessions() {
+			if session.Phase() != PhaseDisconnected {
+				t.Error("saving before every player was disconnected")
+			}
+		}
+		saved = true
+		return nil
+	})
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe(ctx) }()
+
+	dialCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var client *quic.Conn
+	var err error
+	// the listener may not be up yet
+	for client == nil {
+		client, err = quic.DialAddr(dialCtx, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"hytale/1"},
+		}, &quic.Config{HandshakeIdleTimeout: 100 * time.Millisecond})
+		if err != nil && dialCtx.Err() != nil {
+			t.Fatal(err)
+		}
+	}
+	stream, err := client.OpenStreamSync(dialCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	for len(srv.Sessions()) == 0 || srv.Sessions()[0].Phase() != PhaseSetup {
+		if dialCtx.Err() != nil {
+			t.Fatal("client never logged in")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stop()
+	if reason := readDisconnect(t, client, NewFrameReader(stream, 0)); reason != ShutdownReason {
+		t.Errorf("reason = %q", reason)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ListenAndServe = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	if !saved {
+		t.Error("shutdown hook did not run")
+	}
+}
+
+func TestServerShutdownLateConnection(t *testing.T) {
+	server, client, _ := testPair(t)
+	srv := NewServer(Config{Authenticator: auth.Offline{}, ShutdownTimeout: 5 * time.Second})
+
+	// the connection is accepted, but registers only after shutdown took
+	// its snapshot of the sessions
+	accepted := make(chan struct{})
+	srv.conns.Go(func() {
+		<-accepted
+		srv.handleConnection(context.Background(), server)
+	})
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.shutdown() }()
+	for {
+		srv.mu.Lock()
+		stopping := srv.stopping
+		srv.mu.Unlock()
+		if stopping {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(accepted)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown waited for the late connection")
+	}
+	<-client.Context().Done()
+	var appErr *quic.ApplicationError
+	if !errors.As(context.Cause(client.Context()), &appErr) || appErr.ErrorMessage != ShutdownReason {
+		t.Errorf("client closed with %v", context.Cause(client.Context()))
+	}
+}
@@ -0,0 +1,269 @@
+package network
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"hygoal/internal/protocol"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Phase is where a connection is in its lifecycle. Phases only move
+// forward, and each accepts its own set of packets.
+type Phase int
+
+const (
+	// PhaseHandshake lasts until the QUIC handshake completes.
+	PhaseHandshake Phase = iota
+	// PhaseConnect waits for the client's Connect.
+	PhaseConnect
+	// PhaseAuthentication verifies who the client claims to be.
+	PhaseAuthentication
+	// PhaseSetup sends the client what it needs before joining, assets
+	// included.
+	PhaseSetup
+	// PhasePlay is the client in the world.
+	PhasePlay
+	// PhaseDisconnected is final, no packet is accepted anymore.
+	PhaseDisconnected
+)
+
+var phaseNames = [...]string{"handshake", "connect", "authentication", "setup", "play", "disconnected"}
+
+func (p Phase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+	return phaseNames[p]
+}
+
+// PhaseTimeouts bounds how long a connection may stay in a phase, no limit
+// for phases left out or set to 0.
+type PhaseTimeouts map[Phase]time.Duration
+
+// Handler handles one decoded packet. Returning an error disconnects the
+// client with the error as the reason.
+type Handler func(session *Session, packet protocol.Packet) error
+
+// Handlers maps the packets each phase accepts to their handler. Packets
+// without a handler in the current phase are illegal.
+type Handlers struct {
+	byPhase map[Phase]map[uint32]Handler
+}
+
+func NewHandlers() *Handlers {
+	return &Handlers{byPhase: map[Phase]map[uint32]Handler{}}
+}
+
+// Handle registers handler for packets with id received during phase.
+func (h *Handlers) Handle(phase Phase, id uint32, handler Handler) {
+	if h.byPhase[phase] == nil {
+		h.byPhase[phase] = map[uint32]Handler{}
+	}
+	h.byPhase[phase][id] = handler
+}
+
+// HandlePacket registers a handler typed to the packet it receives.
+func HandlePacket[P protocol.Packet](h *Handlers, phase Phase, handler func(session *Session, packet P) error) {
+	var zero P
+	h.Handle(phase, zero.ID(), func(session *Session, packet protocol.Packet) error {
+		return handler(session, packet.(P))
+	})
+}
+
+func (h *Handlers) lookup(phase Phase, id uint32) (Handler, bool) {
+	handler, ok := h.byPhase[phase][id]
+	return handler, ok
+}
+
+// disconnectTimeout bounds how long Disconnect waits for the client to
+// receive the Disconnect packet and hang up.
+const disconnectTimeout = time.Second
+
+// Session is a connection going through the phases, dispatching the
+// packets it receives to the handlers of its current phase.
+type Session struct {
+	*Conn
+
+	// ID numbers the connection within the server, as the conn attribute
+	// of its logs.
+	ID uint64
+
+	handlers *Handlers
+	timeouts PhaseTimeouts
+
+	mu       sync.Mutex
+	phase    Phase
+	deadline *time.Timer
+	// base carries the connection and, once known, the identity; logger
+	// adds the current phase to it
+	base   *slog.Logger
+	logger *slog.Logger
+
+	keepalive keepalive
+
+	// Username and UUID are set with SetIdentity once the client was
+	// authenticated, and not changed afterwards.
+	Username string
+	UUID     uuid.UUID
+}
+
+// NewSession returns a session in PhaseHandshake logging to logger, or
+// slog.Default when nil.
+func NewSession(conn *Conn, handlers *Handlers, timeouts PhaseTimeouts, logger *slog.Logger) *Session {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Session{Conn: conn, handlers: handlers, timeouts: timeouts, base: logger}
+	s.logger = logger.With("phase", s.phase.String())
+	return s
+}
+
+// Logger returns the logger of the session, carrying the connection,
+// identity and current phase.
+func (s *Session) Logger() *slog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logger
+}
+
+// SetIdentity records who the client was authenticated as.
+func (s *Session) SetIdentity(username string, id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Username = username
+	s.UUID = id
+	s.base = s.base.With("username", username, "uuid", id.String())
+	s.logger = s.base.With("phase", s.phase.String())
+}
+
+// username returns the Username, empty before authentication.
+func (s *Session) username() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Username
+}
+
+// PeerCertificate returns the certificate the client presented in the TLS
+// handshake, nil if it sent none.
+func (s *Session) PeerCertificate() *x509.Certificate {
+	certs := s.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs[0]
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the client
+// certificate, empty if it sent none.
+func (s *Session) CertificateFingerprint() string {
+	cert := s.PeerCertificate()
+	if cert == nil {
+		return ""
+	}
+	return Fingerprint(cert)
+}
+
+// Phase returns the current phase.
+func (s *Session) Phase() Phase {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.phase
+}
+
+// SetPhase moves the session forward to phase and restarts the phase
+// timeout. Moving backwards, or out of PhaseDisconnected, is an error.
+func (s *Session) SetPhase(phase Phase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if phase <= s.phase {
+		return fmt.Errorf("cannot move from phase %s to %s", s.phase, phase)
+	}
+
+	s.phase = phase
+	s.logger = s.base.With("phase", phase.String())
+	s.logger.Debug("entered phase")
+	s.stopDeadline()
+	if timeout := s.timeouts[phase]; timeout > 0 && phase != PhaseDisconnected {
+		s.deadline = time.AfterFunc(timeout, func() {
+			// the timer may fire just as the phase ends
+			if s.Phase() == phase {
+				s.Disconnect(fmt.Sprintf("timed out in %s phase", phase))
+			}
+		})
+	}
+	return nil
+}
+
+// Handle dispatches packet to the handler of the current phase. Packets the
+// phase does not accept, and handler errors, disconnect the client; the
+// returned error says why.
+func (s *Session) Handle(packet protocol.Packet) error {
+	phase := s.Phase()
+	if phase == PhaseDisconnected {
+		return ErrConnClosed
+	}
+
+	handler, ok := s.handlers.lookup(phase, packet.ID())
+	if !ok {
+		err := fmt.Errorf("illegal packet %s in %s phase", protocol.PacketName(packet.ID()), phase)
+		s.Disconnect(err.Error())
+		return err
+	}
+	if err := handler(s, packet); err != nil {
+		s.Disconnect(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Disconnect tells the client why it is disconnected, gives it a moment to
+// read that and closes the connection.
+func (s *Session) Disconnect(reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	return s.DisconnectContext(ctx, reason)
+}
+
+// DisconnectContext is Disconnect waiting for the client until ctx is done.
+func (s *Session) DisconnectContext(ctx context.Context, reason string) error {
+	s.mu.Lock()
+	if s.phase == PhaseDisconnected {
+		s.mu.Unlock()
+		return nil
+	}
+	logger := s.logger
+	s.phase = PhaseDisconnected
+	s.logger = s.base.With("phase", s.phase.String())
+	s.stopDeadline()
+	s.mu.Unlock()
+
+	logger.Info("disconnecting", "reason", reason)
+	s.SendContext(ctx, &protocol.Disconnect{DisconnectType: protocol.DISCONNECT, Reason: &reason})
+	return s.Close(ctx, 0, reason)
+}
+
+// Closed marks the session disconnected after the connection went away on
+// its own.
+func (s *Session) Closed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.phase != PhaseDisconnected {
+		s.logger.Info("connection closed")
+	}
+	s.phase = PhaseDisconnected
+	s.logger = s.base.With("phase", s.phase.String())
+	s.stopDeadline()
+}
+
+// stopDeadline cancels the phase timeout, with mu held.
+func (s *Session) stopDeadline() {
+	if s.deadline != nil {
+		s.deadline.Stop()
+		s.deadline = nil
+	}
+}
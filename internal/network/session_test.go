@@ -0,0 +1,297 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hygoal/internal/auth"
+	"hygoal/internal/auth/authtest"
+	"hygoal/internal/protocol"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quic-go/quic-go"
+)
+
+// readDisconnect reads frames until the Disconnect the server sent, hangs
+// up like a client would and returns the reason.
+func readDisconnect(t *testing.T, client *quic.Conn, frames *FrameReader) string {
+	t.Helper()
+
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			t.Fatalf("no Disconnect received: %v", err)
+		}
+		packet, err := protocol.DecodeByID(frame.ID, frame.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if disconnect, ok := packet.(*protocol.Disconnect); ok {
+			client.CloseWithError(0, "")
+			if disconnect.Reason == nil {
+				return ""
+			}
+			return *disconnect.Reason
+		}
+	}
+}
+
+func TestPhaseOrder(t *testing.T) {
+	session := NewSession(nil, NewHandlers(), nil, nil)
+	if err := session.SetPhase(PhaseConnect); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SetPhase(PhaseSetup); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SetPhase(PhaseConnect); err == nil {
+		t.Error("moved back from setup to connect")
+	}
+	if session.Phase() != PhaseSetup || session.Phase().String() != "setup" {
+		t.Errorf("phase = %v", session.Phase())
+	}
+}
+
+func TestSessionDispatch(t *testing.T) {
+	server, client, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	frames := acceptTestStream(t, conn, stream)
+
+	handled := 0
+	handlers := NewHandlers()
+	HandlePacket(handlers, PhaseConnect, func(session *Session, packet *protocol.Connect) error {
+		handled++
+		return session.SetPhase(PhaseAuthentication)
+	})
+
+	session := NewSession(conn, handlers, nil, nil)
+	session.SetPhase(PhaseConnect)
+	if err := session.Handle(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	if handled != 1 || session.Phase() != PhaseAuthentication {
+		t.Fatalf("handled %d, phase %v", handled, session.Phase())
+	}
+
+	// Connect is only legal in the connect phase; Handle waits for the
+	// client to hang up, so it reads concurrently
+	errs := make(chan error, 1)
+	go func() { errs <- session.Handle(testConnect()) }()
+	if reason := readDisconnect(t, client, frames); reason != "illegal packet Connect in authentication phase" {
+		t.Errorf("reason = %q", reason)
+	}
+	if err := <-errs; err == nil || handled != 1 {
+		t.Fatalf("illegal packet handled: %v", err)
+	}
+	if session.Phase() != PhaseDisconnected {
+		t.Errorf("phase = %v", session.Phase())
+	}
+	if err := session.Send(testConnect()); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("Send after disconnect = %v", err)
+	}
+}
+
+func TestSessionHandlerError(t *testing.T) {
+	server, client, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	frames := acceptTestStream(t, conn, stream)
+
+	handlers := NewHandlers()
+	HandlePacket(handlers, PhaseConnect, func(session *Session, packet *protocol.Connect) error {
+		return errors.New("banned")
+	})
+	session := NewSession(conn, handlers, nil, nil)
+	session.SetPhase(PhaseConnect)
+	go session.Handle(testConnect())
+
+	if reason := readDisconnect(t, client, frames); reason != "banned" {
+		t.Errorf("reason = %q", reason)
+	}
+}
+
+func TestSessionPhaseTimeout(t *testing.T) {
+	server, client, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	frames := acceptTestStream(t, conn, stream)
+
+	session := NewSession(conn, NewHandlers(), PhaseTimeouts{PhaseConnect: 50 * time.Millisecond}, nil)
+	session.SetPhase(PhaseConnect)
+
+	if reason := readDisconnect(t, client, frames); reason != "timed out in connect phase" {
+		t.Errorf("reason = %q", reason)
+	}
+	select {
+	case <-server.Context().Done():
+	case <-time.After(time.Second):
+		t.Error("connection still open after the timeout")
+	}
+}
+
+func TestServerLogin(t *testing.T) {
+	server, client, stream := testPair(t)
+	srv := NewServer(Config{PhaseTimeouts: PhaseTimeouts{PhaseConnect: 5 * time.Second}, Authenticator: auth.Offline{}})
+	go srv.handleConnection(context.Background(), server)
+
+	writer := NewFrameWriter(stream, 0)
+	if err := writer.WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	// a second Connect arrives after the login moved on
+	if err := writer.WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+
+	reason := readDisconnect(t, client, NewFrameReader(stream, 0))
+	if !strings.HasPrefix(reason, "illegal packet Connect") {
+		t.Errorf("reason = %q", reason)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	select {
+	case <-server.Context().Done():
+	case <-ctx.Done():
+		t.Error("connection still open")
+	}
+}
+
+// waitForPhase waits until the only session of srv reached phase.
+func waitForPhase(t *testing.T, srv *Server, phase Phase) *Session {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.Sessions()) == 0 || srv.Sessions()[0].Phase() < phase {
+		if time.Now().After(deadline) {
+			t.Fatalf("session never reached the %s phase", phase)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return srv.Sessions()[0]
+}
+
+func TestServerOfflineLogin(t *testing.T) {
+	server, client, stream := testPair(t)
+	defer client.CloseWithError(0, "")
+	srv := NewServer(Config{Authenticator: auth.Offline{}})
+	go srv.handleConnection(context.Background(), server)
+
+	if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	session := waitForPhase(t, srv, PhaseSetup)
+	if session.Username != "Steve" || session.UUID != auth.OfflineUUID("Steve") {
+		t.Errorf("logged in as %s (%s)", session.Username, session.UUID)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	issuer, err := authtest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := NewSelfSignedServerCert("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, err := NewSelfSignedServerCert("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, other := testConnect().UUID, uuid.New()
+	token := issuer.Sign("ed", authtest.Claims("Steve", player, clientCert.Leaf))
+
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		token  string
+		reason string
+	}{
+		{"bound", []tls.Certificate{clientCert}, token, ""},
+		{"ES256", []tls.Certificate{clientCert}, issuer.Sign("ec", authtest.Claims("Steve", player, clientCert.Leaf)), ""},
+		{"replayed", []tls.Certificate{otherCert}, token, auth.ErrCertificateMismatch.Error()},
+		{"no certificate", nil, token, auth.ErrCertificateMismatch.Error() + ": client presented no certificate"},
+		{"no token", []tls.Certificate{clientCert}, "", auth.ErrInvalidClaims.Error() + ": no identity token"},
+		{"other player", []tls.Certificate{clientCert}, issuer.Sign("ed", authtest.Claims("Steve", other, clientCert.Leaf)),
+			fmt.Sprintf("%s: issued to %q, not %s", auth.ErrInvalidClaims, other, player)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client, stream := testPairWithCert(t, test.certs)
+			srv := NewServer(Config{Authenticator: &auth.JWTAuthenticator{Keys: issuer.Keys(), Audience: authtest.Audience}})
+			go srv.handleConnection(context.Background(), server)
+
+			connect := testConnect()
+			if test.token != "" {
+				connect.IdentityToken = &test.token
+			}
+			if err := NewFrameWriter(stream, 0).WritePacket(connect); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.reason == "" {
+				session := waitForPhase(t, srv, PhaseSetup)
+				if session.UUID != player || session.CertificateFingerprint() != Fingerprint(clientCert.Leaf) {
+					t.Errorf("logged in as %s with %s", session.UUID, session.CertificateFingerprint())
+				}
+				client.CloseWithError(0, "")
+				return
+			}
+			if reason := readDisconnect(t, client, NewFrameReader(stream, 0)); reason != test.reason {
+				t.Errorf("reason = %q, want %q", reason, test.reason)
+			}
+		})
+	}
+}
+
+func TestSessionLogger(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	server, client, stream := testPair(t)
+	defer client.CloseWithError(0, "")
+	srv := NewServer(Config{Authenticator: auth.Offline{}, Logger: logger})
+	go srv.handleConnection(context.Background(), server)
+
+	if err := NewFrameWriter(stream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	session := waitForPhase(t, srv, PhaseSetup)
+	session.Logger().Info("checkpoint")
+
+	logs := out.String()
+	for _, want := range []string{
+		`msg="connection accepted" subsystem=conn conn=1 remote=127.0.0.1:`,
+		`msg=connecting subsystem=conn conn=1`,
+		`msg=checkpoint subsystem=conn conn=1 remote=127.0.0.1:`,
+		`username=Steve uuid=` + auth.OfflineUUID("Steve").String() + ` phase=setup`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("%q missing from\n%s", want, logs)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to log to from several goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/quic-go/quic-go"
+)
+
+// StreamRole is what a stream the client opens carries. Roles follow the
+// order the client opens its streams in: the first is the control stream,
+// the second the world stream and so on.
+type StreamRole int
+
+const (
+	// StreamControl carries the login, keepalives and every packet not
+	// routed to another stream.
+	StreamControl StreamRole = iota
+	// StreamWorld carries chunks and entities.
+	StreamWorld
+	// StreamAssets carries asset transfers during setup.
+	StreamAssets
+	// StreamChat carries chat messages.
+	StreamChat
+
+	streamRoles = iota
+)
+
+var streamRoleNames = [...]string{"control", "world", "assets", "chat"}
+
+func (r StreamRole) String() string {
+	if r < 0 || int(r) >= len(streamRoleNames) {
+		return fmt.Sprintf("StreamRole(%d)", int(r))
+	}
+	return streamRoleNames[r]
+}
+
+// streamRole returns the role of the client stream with id, false for
+// streams opened after every role has one. The IDs of the bidirectional
+// streams a client opens count up in steps of 4 from 0.
+func streamRole(id quic.StreamID) (StreamRole, bool) {
+	index := int64(id) / 4
+	if index >= streamRoles {
+		return 0, false
+	}
+	return StreamRole(index), true
+}
+
+// StreamRoutes maps packet IDs to the stream they are sent on. Packets
+// without a route, or routed to a stream the client has not opened, go on
+// the control stream.
+type StreamRoutes map[uint32]StreamRole
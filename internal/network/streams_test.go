@@ -0,0 +1,98 @@
+package network
+
+import (
+	"context"
+	"hygoal/internal/auth"
+	"hygoal/internal/protocol"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestStreamRole(t *testing.T) {
+	for id, want := range map[quic.StreamID]StreamRole{0: StreamControl, 4: StreamWorld, 8: StreamAssets, 12: StreamChat} {
+		if role, ok := streamRole(id); !ok || role != want {
+			t.Errorf("stream %d has role %v, want %v", id, role, want)
+		}
+	}
+	if role, ok := streamRole(16); ok {
+		t.Errorf("stream 16 has role %v", role)
+	}
+	if StreamAssets.String() != "assets" {
+		t.Errorf("StreamAssets = %q", StreamAssets)
+	}
+}
+
+func TestConnRoutes(t *testing.T) {
+	server, client, stream := testPair(t)
+	conn := NewConn(server, 0, 0)
+	disconnectID := (&protocol.Disconnect{}).ID()
+	conn.routes = StreamRoutes{disconnectID: StreamWorld}
+	control := acceptTestStream(t, conn, stream)
+
+	// routed to a stream the client has not opened yet
+	if err := conn.Send(&protocol.Disconnect{}); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := control.ReadFrame(); err != nil || frame.ID != disconnectID {
+		t.Fatalf("control stream read %d, %v", frame.ID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	worldStream, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFrameWriter(worldStream, 0).WritePacket(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	serverStream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role, _ := streamRole(serverStream.StreamID()); role != StreamWorld || !conn.Attach(role, serverStream) {
+		t.Fatalf("stream %d not attached as the world stream", serverStream.StreamID())
+	}
+
+	if err := conn.Send(&protocol.Disconnect{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Send(testConnect()); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := NewFrameReader(worldStream, 0).ReadFrame(); err != nil || frame.ID != disconnectID {
+		t.Fatalf("world stream read %d, %v", frame.ID, err)
+	}
+	if frame, err := control.ReadFrame(); err != nil || frame.ID != testConnect().ID() {
+		t.Fatalf("control stream read %d, %v", frame.ID, err)
+	}
+}
+
+func TestServerConcurrentStreams(t *testing.T) {
+	server, client, stream := testPair(t)
+	defer client.CloseWithError(0, "")
+	srv := NewServer(Config{Authenticator: auth.Offline{}})
+	go srv.handleConnection(context.Background(), server)
+
+	// the first stream stalls in the middle of a frame
+	connect, err := AppendPacketFrame(nil, testConnect(), DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Write(connect[:FrameHeaderSize+1]); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	second, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Write(connect); err != nil {
+		t.Fatal(err)
+	}
+	waitForPhase(t, srv, PhaseSetup)
+}
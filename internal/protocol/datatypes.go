@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"unsafe"
 )
 
 func DecodeHostAddress(payload []byte, offset int) (HostAddress, int, error) {
@@ -44,24 +45,22 @@ func DecodeHostAddress(payload []byte, offset int) (HostAddress, int, error) {
 	}, consumed, nil
 }
 
-func ReadVarInt(data []byte, pos int) (value int, size int, _ error) {
-	var shift uint = 0
-	for {
-		if pos+size >= len(data) {
-			return 0, size, io.ErrUnexpectedEOF
-		}
-		b := data[pos+size]
-		size++
-		value |= int(b&0x7F) << shift
-		if (b & 0x80) == 0 {
-			break
-		}
-		shift += 7
-		if shift > 28 {
-			break
-		}
-	}
-	return value, size, nil
+// DecodeHostAddressInto is the allocation free form of DecodeHostAddress,
+// the hostname is a view of payload.
+func DecodeHostAddressInto(address *HostAddress, payload []byte, offset int) (int, error) {
+	if offset+2 > len(payload) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	hostname, n, err := ReadVarStringView(payload, offset+2, 256, false)
+	if err != nil {
+		return 0, fmt.Errorf("host: %w", err)
+	}
+
+	address.Port = binary.LittleEndian.Uint16(payload[offset : offset+2])
+	address.Hostname = hostname
+
+	return 2 + n, nil
 }
 
 func ReadVarString(payload []byte, pos int, max int, ascii bool) (string, int, error) {
@@ -86,3 +85,79 @@ func ReadVarString(payload []byte, pos int, max int, ascii bool) (string, int, e
 	// identity token is UTF-8
 	return string(b), nLen + n, nil
 }
+
+// ReadVarStringView is ReadVarString without the copy: the string shares
+// memory with payload.
+func ReadVarStringView(payload []byte, pos int, max int, ascii bool) (string, int, error) {
+	n, nLen, err := ReadVarInt(payload, pos)
+	if err != nil {
+		return "", 0, err
+	}
+	if n < 0 || n > max {
+		return "", 0, fmt.Errorf("var string len %d > max %d", n, max)
+	}
+	start := pos + nLen
+	end := start + n
+	if end > len(payload) {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	return BytesView(payload[start:end]), nLen + n, nil
+}
+
+// BytesView returns b as a string without copying. b must not be modified
+// while the string is in use.
+func BytesView(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+func AppendHostAddress(buf []byte, address HostAddress) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint16(buf, address.Port)
+	return AppendVarString(buf, address.Hostname, 256)
+}
+
+func AppendVarString(buf []byte, s string, max int) ([]byte, error) {
+	if len(s) > max {
+		return nil, fmt.Errorf("var string len %d > max %d", len(s), max)
+	}
+	buf = AppendVarInt(buf, int32(len(s)))
+	return append(buf, s...), nil
+}
+
+// AppendFixedString writes s into a field of exactly size bytes, padding
+// with zeros.
+func AppendFixedString(buf []byte, s string, size int) ([]byte, error) {
+	if len(s) > size {
+		return nil, fmt.Errorf("fixed string len %d > size %d", len(s), size)
+	}
+	buf = append(buf, s...)
+	for i := len(s); i < size; i++ {
+		buf = append(buf, 0)
+	}
+	return buf, nil
+}
+
+// FixedString returns the content of a fixed size string field, without
+// the zero padding AppendFixedString adds.
+func FixedString(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+func AppendByteArray(buf []byte, b []byte, min int, max int) ([]byte, error) {
+	if len(b) < min || len(b) > max {
+		return nil, fmt.Errorf("byte array len %d outside [%d, %d]", len(b), min, max)
+	}
+	buf = AppendVarInt(buf, int32(len(b)))
+	return append(buf, b...), nil
+}
+
+// PutOffset writes a variable field offset (relative to the variable
+// block, or -1 when absent) into the offset table slot at pos.
+func PutOffset(buf []byte, pos int, offset int) {
+	binary.LittleEndian.PutUint32(buf[pos:pos+4], uint32(int32(offset)))
+}
@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func benchmarkConnectPayload(b *testing.B) []byte {
+	language := "en-GB"
+	token := strings.Repeat("t", 1024)
+	payload, err := EncodeConnect(nil, &Connect{
+		ProtocolHash:   strings.Repeat("f", 64),
+		UUID:           uuid.New(),
+		Language:       &language,
+		IdentityToken:  &token,
+		Username:       "Steve",
+		ReferralSource: &HostAddress{Port: 5520, Hostname: "play.example.com"},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return payload
+}
+
+func BenchmarkDecodeConnect(b *testing.B) {
+	payload := benchmarkConnectPayload(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := DecodeConnect(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeConnectInto(b *testing.B) {
+	payload := benchmarkConnectPayload(b)
+	packet := &Connect{}
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if err := DecodeConnectInto(packet, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodePooled(b *testing.B) {
+	payload := benchmarkConnectPayload(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		packet, err := DecodePooled(0, payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		Release(packet)
+	}
+}
+
+func BenchmarkEncodeConnect(b *testing.B) {
+	packet, err := DecodeConnect(benchmarkConnectPayload(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 0, 2048)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := EncodeConnect(buf[:0], packet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeConnectIntoAllocations(t *testing.T) {
+	language := "en-GB"
+	payload, err := EncodeConnect(nil, &Connect{
+		ProtocolHash: strings.Repeat("f", 64),
+		Language:     &language,
+		Username:     "Steve",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := &Connect{}
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := DecodeConnectInto(packet, payload); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("DecodeConnectInto allocated %v times per run", allocs)
+	}
+	if *packet.Language != language || packet.Username != "Steve" {
+		t.Fatalf("unexpected decode result %+v", packet)
+	}
+}
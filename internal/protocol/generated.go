@@ -5,12 +5,15 @@ package protocol
 import (
 	"encoding/binary"
 	"fmt"
+	"sync"
 
 	"github.com/google/uuid"
 )
 
 type Packet interface {
 	ID() uint32
+	// MaxSize is the largest payload the packet can have.
+	MaxSize() int
 }
 
 type ClientType byte
@@ -31,12 +34,19 @@ type Connect struct {
 	ReferralSource *HostAddress
 }
 
+// GetLanguage returns Language, or "en-US" when it is absent.
+func (p *Connect) GetLanguage() string {
+	if p.Language == nil {
+		return "en-US"
+	}
+	return *p.Language
+}
+
 func DecodeConnect(payload []byte) (Packet, error) {
 	if len(payload) < 102 {
 		return nil, fmt.Errorf("Connect payload too small: %d", len(payload))
 	}
 
-	var err error
 	packet := &Connect{}
 
 	// optional fields bitfield
@@ -48,29 +58,29 @@ func DecodeConnect(payload []byte) (Packet, error) {
 
 	protocolHashPos := 1
 
-	protocolHashRaw := payload[protocolHashPos:64]
+	protocolHashRaw := FixedString(payload[protocolHashPos : protocolHashPos+64])
+
 	protocolHash := string(protocolHashRaw)
 
 	packet.ProtocolHash = protocolHash
+
 	// Field clientType
 
 	clientTypePos := 65
 
-	clientType := payload[clientTypePos]
-	packet.ClientType = ClientType(clientType)
-	// Field UUID
+	clientType := ClientType(payload[clientTypePos])
+	packet.ClientType = clientType
 
-	var UUID [16]byte
+	// Field UUID
 
 	UUIDPos := 66
 
-	copy(UUID[:], payload[UUIDPos:UUIDPos+16])
-
-	var UUIDSlice []byte = UUID[:]
-	packet.UUID, err = uuid.FromBytes(UUIDSlice)
+	UUID, err := uuid.FromBytes(payload[UUIDPos : UUIDPos+16])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse UUID: %w", err)
 	}
+	packet.UUID = UUID
+
 	// offsets
 	languageOffset := int(int32(binary.LittleEndian.Uint32(payload[82:86])))
 	identityTokenOffset := int(int32(binary.LittleEndian.Uint32(payload[86:90])))
@@ -80,6 +90,9 @@ func DecodeConnect(payload []byte) (Packet, error) {
 
 	// variable-length fields
 	if (nullBits & 0x01) != 0 {
+		if languageOffset < 0 || languageOffset > len(payload)-102 {
+			return nil, fmt.Errorf("invalid language offset: %d", languageOffset)
+		}
 
 		// Field language
 
@@ -94,6 +107,9 @@ func DecodeConnect(payload []byte) (Packet, error) {
 	}
 
 	if (nullBits & 0x02) != 0 {
+		if identityTokenOffset < 0 || identityTokenOffset > len(payload)-102 {
+			return nil, fmt.Errorf("invalid identityToken offset: %d", identityTokenOffset)
+		}
 
 		// Field identityToken
 
@@ -107,6 +123,10 @@ func DecodeConnect(payload []byte) (Packet, error) {
 		packet.IdentityToken = &identityToken
 	}
 
+	if usernameOffset < 0 || usernameOffset > len(payload)-102 {
+		return nil, fmt.Errorf("invalid username offset: %d", usernameOffset)
+	}
+
 	// Field username
 
 	usernamePos := 102 + usernameOffset
@@ -117,7 +137,11 @@ func DecodeConnect(payload []byte) (Packet, error) {
 	}
 
 	packet.Username = username
+
 	if (nullBits & 0x04) != 0 {
+		if referralDataOffset < 0 || referralDataOffset > len(payload)-102 {
+			return nil, fmt.Errorf("invalid referralData offset: %d", referralDataOffset)
+		}
 
 		// Field referralData
 
@@ -145,10 +169,14 @@ func DecodeConnect(payload []byte) (Packet, error) {
 
 		ReferralDataValue := make([]byte, referralDataLen)
 		copy(ReferralDataValue, payload[referralDataStart:referralDataEnd])
+
 		packet.ReferralData = &ReferralDataValue
 	}
 
 	if (nullBits & 0x08) != 0 {
+		if referralSourceOffset < 0 || referralSourceOffset > len(payload)-102 {
+			return nil, fmt.Errorf("invalid referralSource offset: %d", referralSourceOffset)
+		}
 
 		// Field referralSource
 
@@ -159,15 +187,806 @@ func DecodeConnect(payload []byte) (Packet, error) {
 			return nil, fmt.Errorf("error decoding referralSource: %v", err)
 		}
 		packet.ReferralSource = &referralSource
+
 	}
 
 	return packet, nil
 }
+
+// DecodeConnectInto decodes payload into packet, reusing its storage.
+// Strings and byte slices are views of payload, so payload must not be
+// modified while packet is in use.
+func DecodeConnectInto(packet *Connect, payload []byte) error {
+	if len(payload) < 102 {
+		return fmt.Errorf("Connect payload too small: %d", len(payload))
+	}
+
+	var err error
+
+	// optional fields bitfield
+	var nullBits byte = payload[0]
+
+	// fixed fields
+
+	// Field protocolHash
+
+	protocolHashPos := 1
+
+	protocolHashRaw := FixedString(payload[protocolHashPos : protocolHashPos+64])
+
+	protocolHash := BytesView(protocolHashRaw)
+
+	packet.ProtocolHash = protocolHash
+
+	// Field clientType
+
+	clientTypePos := 65
+
+	clientType := ClientType(payload[clientTypePos])
+	packet.ClientType = clientType
+
+	// Field UUID
+
+	UUIDPos := 66
+
+	UUID, err := uuid.FromBytes(payload[UUIDPos : UUIDPos+16])
+	if err != nil {
+		return fmt.Errorf("failed to parse UUID: %w", err)
+	}
+	packet.UUID = UUID
+
+	// offsets
+	languageOffset := int(int32(binary.LittleEndian.Uint32(payload[82:86])))
+	identityTokenOffset := int(int32(binary.LittleEndian.Uint32(payload[86:90])))
+	usernameOffset := int(int32(binary.LittleEndian.Uint32(payload[90:94])))
+	referralDataOffset := int(int32(binary.LittleEndian.Uint32(payload[94:98])))
+	referralSourceOffset := int(int32(binary.LittleEndian.Uint32(payload[98:102])))
+
+	// variable-length fields
+	if (nullBits & 0x01) != 0 {
+		if languageOffset < 0 || languageOffset > len(payload)-102 {
+			return fmt.Errorf("invalid language offset: %d", languageOffset)
+		}
+
+		// Field language
+
+		languagePos := 102 + languageOffset
+
+		language, _, err := ReadVarStringView(payload, languagePos, 128, false)
+		if err != nil {
+			return fmt.Errorf("error reading language: %v", err)
+		}
+
+		if packet.Language == nil {
+			packet.Language = new(string)
+		}
+		*packet.Language = language
+	} else {
+		packet.Language = nil
+	}
+
+	if (nullBits & 0x02) != 0 {
+		if identityTokenOffset < 0 || identityTokenOffset > len(payload)-102 {
+			return fmt.Errorf("invalid identityToken offset: %d", identityTokenOffset)
+		}
+
+		// Field identityToken
+
+		identityTokenPos := 102 + identityTokenOffset
+
+		identityToken, _, err := ReadVarStringView(payload, identityTokenPos, 8192, false)
+		if err != nil {
+			return fmt.Errorf("error reading identityToken: %v", err)
+		}
+
+		if packet.IdentityToken == nil {
+			packet.IdentityToken = new(string)
+		}
+		*packet.IdentityToken = identityToken
+	} else {
+		packet.IdentityToken = nil
+	}
+
+	if usernameOffset < 0 || usernameOffset > len(payload)-102 {
+		return fmt.Errorf("invalid username offset: %d", usernameOffset)
+	}
+
+	// Field username
+
+	usernamePos := 102 + usernameOffset
+
+	username, _, err := ReadVarStringView(payload, usernamePos, 16, false)
+	if err != nil {
+		return fmt.Errorf("error reading username: %v", err)
+	}
+
+	packet.Username = username
+
+	if (nullBits & 0x04) != 0 {
+		if referralDataOffset < 0 || referralDataOffset > len(payload)-102 {
+			return fmt.Errorf("invalid referralData offset: %d", referralDataOffset)
+		}
+
+		// Field referralData
+
+		referralDataPos := 102 + referralDataOffset
+
+		referralDataLen, referralDataLenSize, err := ReadVarInt(payload, referralDataPos)
+		if err != nil {
+			return fmt.Errorf("error reading referralData length: %v", err)
+		}
+
+		if referralDataLen < 0 {
+
+			return fmt.Errorf("invalid referralData length: %d", referralDataLen)
+		}
+
+		if referralDataLen > 4096 {
+			return fmt.Errorf("referralData length too large: %d", referralDataLen)
+		}
+
+		referralDataStart := referralDataPos + referralDataLenSize
+		referralDataEnd := referralDataStart + int(referralDataLen)
+		if referralDataEnd > len(payload) {
+			return fmt.Errorf("referralData data exceeds payload length")
+		}
+
+		ReferralDataValue := payload[referralDataStart:referralDataEnd]
+
+		if packet.ReferralData == nil {
+			packet.ReferralData = new([]byte)
+		}
+		*packet.ReferralData = ReferralDataValue
+	} else {
+		packet.ReferralData = nil
+	}
+
+	if (nullBits & 0x08) != 0 {
+		if referralSourceOffset < 0 || referralSourceOffset > len(payload)-102 {
+			return fmt.Errorf("invalid referralSource offset: %d", referralSourceOffset)
+		}
+
+		// Field referralSource
+
+		referralSourcePos := 102 + referralSourceOffset
+
+		if packet.ReferralSource == nil {
+			packet.ReferralSource = new(HostAddress)
+		}
+		_, err = DecodeHostAddressInto(packet.ReferralSource, payload, referralSourcePos)
+
+		if err != nil {
+			return fmt.Errorf("error decoding referralSource: %v", err)
+		}
+
+	} else {
+		packet.ReferralSource = nil
+	}
+
+	return nil
+}
+
+var connectPool = sync.Pool{
+	New: func() any { return new(Connect) },
+}
+
+// AcquireConnect returns a Connect from the pool.
+// Its fields hold whatever was last decoded into it.
+func AcquireConnect() *Connect {
+	return connectPool.Get().(*Connect)
+}
+
+func ReleaseConnect(packet *Connect) {
+	connectPool.Put(packet)
+}
+
+func EncodeConnect(buf []byte, p Packet) ([]byte, error) {
+	packet, ok := p.(*Connect)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as Connect", p)
+	}
+
+	var err error
+	start := len(buf)
+
+	// optional fields bitfield
+	var nullBits byte
+	buf = append(buf, 0)
+
+	// fixed fields
+
+	// Field protocolHash
+	buf, err = AppendFixedString(buf, packet.ProtocolHash, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding protocolHash: %w", err)
+	}
+
+	// Field clientType
+	buf = append(buf, byte(packet.ClientType))
+
+	// Field UUID
+	buf = append(buf, packet.UUID[:]...)
+
+	// offsets
+	buf = append(buf, make([]byte, 20)...)
+	varStart := len(buf)
+
+	// variable-length fields
+
+	// Field language
+	if packet.Language != nil && *packet.Language != "en-US" {
+		nullBits |= 0x01
+		PutOffset(buf, start+82, len(buf)-varStart)
+		buf, err = AppendVarString(buf, (*packet.Language), 128)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding language: %w", err)
+		}
+	} else {
+		PutOffset(buf, start+82, -1)
+	}
+
+	// Field identityToken
+	if packet.IdentityToken != nil {
+		nullBits |= 0x02
+		PutOffset(buf, start+86, len(buf)-varStart)
+		buf, err = AppendVarString(buf, (*packet.IdentityToken), 8192)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding identityToken: %w", err)
+		}
+	} else {
+		PutOffset(buf, start+86, -1)
+	}
+
+	// Field username
+	PutOffset(buf, start+90, len(buf)-varStart)
+	buf, err = AppendVarString(buf, packet.Username, 16)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding username: %w", err)
+	}
+
+	// Field referralData
+	if packet.ReferralData != nil {
+		nullBits |= 0x04
+		PutOffset(buf, start+94, len(buf)-varStart)
+		buf, err = AppendByteArray(buf, (*packet.ReferralData), 0, 4096)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding referralData: %w", err)
+		}
+	} else {
+		PutOffset(buf, start+94, -1)
+	}
+
+	// Field referralSource
+	if packet.ReferralSource != nil {
+		nullBits |= 0x08
+		PutOffset(buf, start+98, len(buf)-varStart)
+		buf, err = AppendHostAddress(buf, (*packet.ReferralSource))
+		if err != nil {
+			return nil, fmt.Errorf("error encoding referralSource: %w", err)
+		}
+	} else {
+		PutOffset(buf, start+98, -1)
+	}
+
+	buf[start] = nullBits
+
+	return buf, nil
+}
+
 func (p *Connect) ID() uint32 {
 	return 0
 }
 
+// ConnectMaxSize is the largest payload a valid Connect can have.
+const ConnectMaxSize = 12801
+
+func (p *Connect) MaxSize() int {
+	return ConnectMaxSize
+}
+
+type DisconnectType byte
+
+const (
+	DISCONNECT DisconnectType = iota
+	CRASH      DisconnectType = iota
+)
+
+type Disconnect struct {
+	DisconnectType DisconnectType
+	Reason         *string
+}
+
+func DecodeDisconnect(payload []byte) (Packet, error) {
+	if len(payload) < 6 {
+		return nil, fmt.Errorf("Disconnect payload too small: %d", len(payload))
+	}
+
+	packet := &Disconnect{}
+
+	// optional fields bitfield
+	var nullBits byte = payload[0]
+
+	// fixed fields
+
+	// Field disconnectType
+
+	disconnectTypePos := 1
+
+	disconnectType := DisconnectType(payload[disconnectTypePos])
+	packet.DisconnectType = disconnectType
+
+	// offsets
+	reasonOffset := int(int32(binary.LittleEndian.Uint32(payload[2:6])))
+
+	// variable-length fields
+	if (nullBits & 0x01) != 0 {
+		if reasonOffset < 0 || reasonOffset > len(payload)-6 {
+			return nil, fmt.Errorf("invalid reason offset: %d", reasonOffset)
+		}
+
+		// Field reason
+
+		reasonPos := 6 + reasonOffset
+
+		reason, _, err := ReadVarString(payload, reasonPos, 4096, false)
+		if err != nil {
+			return nil, fmt.Errorf("error reading reason: %v", err)
+		}
+
+		packet.Reason = &reason
+	}
+
+	return packet, nil
+}
+
+// DecodeDisconnectInto decodes payload into packet, reusing its storage.
+// Strings and byte slices are views of payload, so payload must not be
+// modified while packet is in use.
+func DecodeDisconnectInto(packet *Disconnect, payload []byte) error {
+	if len(payload) < 6 {
+		return fmt.Errorf("Disconnect payload too small: %d", len(payload))
+	}
+
+	// optional fields bitfield
+	var nullBits byte = payload[0]
+
+	// fixed fields
+
+	// Field disconnectType
+
+	disconnectTypePos := 1
+
+	disconnectType := DisconnectType(payload[disconnectTypePos])
+	packet.DisconnectType = disconnectType
+
+	// offsets
+	reasonOffset := int(int32(binary.LittleEndian.Uint32(payload[2:6])))
+
+	// variable-length fields
+	if (nullBits & 0x01) != 0 {
+		if reasonOffset < 0 || reasonOffset > len(payload)-6 {
+			return fmt.Errorf("invalid reason offset: %d", reasonOffset)
+		}
+
+		// Field reason
+
+		reasonPos := 6 + reasonOffset
+
+		reason, _, err := ReadVarStringView(payload, reasonPos, 4096, false)
+		if err != nil {
+			return fmt.Errorf("error reading reason: %v", err)
+		}
+
+		if packet.Reason == nil {
+			packet.Reason = new(string)
+		}
+		*packet.Reason = reason
+	} else {
+		packet.Reason = nil
+	}
+
+	return nil
+}
+
+var disconnectPool = sync.Pool{
+	New: func() any { return new(Disconnect) },
+}
+
+// AcquireDisconnect returns a Disconnect from the pool.
+// Its fields hold whatever was last decoded into it.
+func AcquireDisconnect() *Disconnect {
+	return disconnectPool.Get().(*Disconnect)
+}
+
+func ReleaseDisconnect(packet *Disconnect) {
+	disconnectPool.Put(packet)
+}
+
+func EncodeDisconnect(buf []byte, p Packet) ([]byte, error) {
+	packet, ok := p.(*Disconnect)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as Disconnect", p)
+	}
+
+	var err error
+	start := len(buf)
+
+	// optional fields bitfield
+	var nullBits byte
+	buf = append(buf, 0)
+
+	// fixed fields
+
+	// Field disconnectType
+	buf = append(buf, byte(packet.DisconnectType))
+
+	// offsets
+	buf = append(buf, make([]byte, 4)...)
+	varStart := len(buf)
+
+	// variable-length fields
+
+	// Field reason
+	if packet.Reason != nil {
+		nullBits |= 0x01
+		PutOffset(buf, start+2, len(buf)-varStart)
+		buf, err = AppendVarString(buf, (*packet.Reason), 4096)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding reason: %w", err)
+		}
+	} else {
+		PutOffset(buf, start+2, -1)
+	}
+
+	buf[start] = nullBits
+
+	return buf, nil
+}
+
+func (p *Disconnect) ID() uint32 {
+	return 1
+}
+
+// DisconnectMaxSize is the largest payload a valid Disconnect can have.
+const DisconnectMaxSize = 4104
+
+func (p *Disconnect) MaxSize() int {
+	return DisconnectMaxSize
+}
+
+type Ping struct {
+	Sequence      int32
+	LastRTTMillis int32
+}
+
+func DecodePing(payload []byte) (Packet, error) {
+	if len(payload) < 9 {
+		return nil, fmt.Errorf("Ping payload too small: %d", len(payload))
+	}
+
+	packet := &Ping{}
+
+	// fixed fields
+
+	// offsets
+	sequenceOffset := int(int32(binary.LittleEndian.Uint32(payload[1:5])))
+	lastRTTMillisOffset := int(int32(binary.LittleEndian.Uint32(payload[5:9])))
+
+	// variable-length fields
+	if sequenceOffset < 0 || sequenceOffset > len(payload)-9 {
+		return nil, fmt.Errorf("invalid sequence offset: %d", sequenceOffset)
+	}
+
+	// Field sequence
+	sequencePos := 9 + sequenceOffset
+
+	sequenceRaw, _, err := ReadVarInt(payload, sequencePos)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sequence: %v", err)
+	}
+	sequence := int32(sequenceRaw)
+
+	packet.Sequence = sequence
+
+	if lastRTTMillisOffset < 0 || lastRTTMillisOffset > len(payload)-9 {
+		return nil, fmt.Errorf("invalid lastRTTMillis offset: %d", lastRTTMillisOffset)
+	}
+
+	// Field lastRTTMillis
+	lastRTTMillisPos := 9 + lastRTTMillisOffset
+
+	lastRTTMillisRaw, _, err := ReadVarInt(payload, lastRTTMillisPos)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lastRTTMillis: %v", err)
+	}
+	lastRTTMillis := int32(lastRTTMillisRaw)
+
+	packet.LastRTTMillis = lastRTTMillis
+
+	return packet, nil
+}
+
+// DecodePingInto decodes payload into packet, reusing its storage.
+// Strings and byte slices are views of payload, so payload must not be
+// modified while packet is in use.
+func DecodePingInto(packet *Ping, payload []byte) error {
+	if len(payload) < 9 {
+		return fmt.Errorf("Ping payload too small: %d", len(payload))
+	}
+
+	// fixed fields
+
+	// offsets
+	sequenceOffset := int(int32(binary.LittleEndian.Uint32(payload[1:5])))
+	lastRTTMillisOffset := int(int32(binary.LittleEndian.Uint32(payload[5:9])))
+
+	// variable-length fields
+	if sequenceOffset < 0 || sequenceOffset > len(payload)-9 {
+		return fmt.Errorf("invalid sequence offset: %d", sequenceOffset)
+	}
+
+	// Field sequence
+	sequencePos := 9 + sequenceOffset
+
+	sequenceRaw, _, err := ReadVarInt(payload, sequencePos)
+	if err != nil {
+		return fmt.Errorf("error reading sequence: %v", err)
+	}
+	sequence := int32(sequenceRaw)
+
+	packet.Sequence = sequence
+
+	if lastRTTMillisOffset < 0 || lastRTTMillisOffset > len(payload)-9 {
+		return fmt.Errorf("invalid lastRTTMillis offset: %d", lastRTTMillisOffset)
+	}
+
+	// Field lastRTTMillis
+	lastRTTMillisPos := 9 + lastRTTMillisOffset
+
+	lastRTTMillisRaw, _, err := ReadVarInt(payload, lastRTTMillisPos)
+	if err != nil {
+		return fmt.Errorf("error reading lastRTTMillis: %v", err)
+	}
+	lastRTTMillis := int32(lastRTTMillisRaw)
+
+	packet.LastRTTMillis = lastRTTMillis
+
+	return nil
+}
+
+var pingPool = sync.Pool{
+	New: func() any { return new(Ping) },
+}
+
+// AcquirePing returns a Ping from the pool.
+// Its fields hold whatever was last decoded into it.
+func AcquirePing() *Ping {
+	return pingPool.Get().(*Ping)
+}
+
+func ReleasePing(packet *Ping) {
+	pingPool.Put(packet)
+}
+
+func EncodePing(buf []byte, p Packet) ([]byte, error) {
+	packet, ok := p.(*Ping)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as Ping", p)
+	}
+	start := len(buf)
+
+	// optional fields bitfield
+	var nullBits byte
+	buf = append(buf, 0)
+
+	// fixed fields
+
+	// offsets
+	buf = append(buf, make([]byte, 8)...)
+	varStart := len(buf)
+
+	// variable-length fields
+
+	// Field sequence
+	PutOffset(buf, start+1, len(buf)-varStart)
+	buf = AppendVarInt(buf, packet.Sequence)
+
+	// Field lastRTTMillis
+	PutOffset(buf, start+5, len(buf)-varStart)
+	buf = AppendVarInt(buf, packet.LastRTTMillis)
+
+	buf[start] = nullBits
+
+	return buf, nil
+}
+
+func (p *Ping) ID() uint32 {
+	return 2
+}
+
+// PingMaxSize is the largest payload a valid Ping can have.
+const PingMaxSize = 19
+
+func (p *Ping) MaxSize() int {
+	return PingMaxSize
+}
+
+type Pong struct {
+	Sequence int32
+}
+
+func DecodePong(payload []byte) (Packet, error) {
+	if len(payload) < 5 {
+		return nil, fmt.Errorf("Pong payload too small: %d", len(payload))
+	}
+
+	packet := &Pong{}
+
+	// fixed fields
+
+	// offsets
+	sequenceOffset := int(int32(binary.LittleEndian.Uint32(payload[1:5])))
+
+	// variable-length fields
+	if sequenceOffset < 0 || sequenceOffset > len(payload)-5 {
+		return nil, fmt.Errorf("invalid sequence offset: %d", sequenceOffset)
+	}
+
+	// Field sequence
+	sequencePos := 5 + sequenceOffset
+
+	sequenceRaw, _, err := ReadVarInt(payload, sequencePos)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sequence: %v", err)
+	}
+	sequence := int32(sequenceRaw)
+
+	packet.Sequence = sequence
+
+	return packet, nil
+}
+
+// DecodePongInto decodes payload into packet, reusing its storage.
+// Strings and byte slices are views of payload, so payload must not be
+// modified while packet is in use.
+func DecodePongInto(packet *Pong, payload []byte) error {
+	if len(payload) < 5 {
+		return fmt.Errorf("Pong payload too small: %d", len(payload))
+	}
+
+	// fixed fields
+
+	// offsets
+	sequenceOffset := int(int32(binary.LittleEndian.Uint32(payload[1:5])))
+
+	// variable-length fields
+	if sequenceOffset < 0 || sequenceOffset > len(payload)-5 {
+		return fmt.Errorf("invalid sequence offset: %d", sequenceOffset)
+	}
+
+	// Field sequence
+	sequencePos := 5 + sequenceOffset
+
+	sequenceRaw, _, err := ReadVarInt(payload, sequencePos)
+	if err != nil {
+		return fmt.Errorf("error reading sequence: %v", err)
+	}
+	sequence := int32(sequenceRaw)
+
+	packet.Sequence = sequence
+
+	return nil
+}
+
+var pongPool = sync.Pool{
+	New: func() any { return new(Pong) },
+}
+
+// AcquirePong returns a Pong from the pool.
+// Its fields hold whatever was last decoded into it.
+func AcquirePong() *Pong {
+	return pongPool.Get().(*Pong)
+}
+
+func ReleasePong(packet *Pong) {
+	pongPool.Put(packet)
+}
+
+func EncodePong(buf []byte, p Packet) ([]byte, error) {
+	packet, ok := p.(*Pong)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as Pong", p)
+	}
+	start := len(buf)
+
+	// optional fields bitfield
+	var nullBits byte
+	buf = append(buf, 0)
+
+	// fixed fields
+
+	// offsets
+	buf = append(buf, make([]byte, 4)...)
+	varStart := len(buf)
+
+	// variable-length fields
+
+	// Field sequence
+	PutOffset(buf, start+1, len(buf)-varStart)
+	buf = AppendVarInt(buf, packet.Sequence)
+
+	buf[start] = nullBits
+
+	return buf, nil
+}
+
+func (p *Pong) ID() uint32 {
+	return 3
+}
+
+// PongMaxSize is the largest payload a valid Pong can have.
+const PongMaxSize = 10
+
+func (p *Pong) MaxSize() int {
+	return PongMaxSize
+}
+
 type HostAddress struct {
 	Port     uint16
 	Hostname string
 }
+
+var packetRegistry = []PacketInfo{
+	{
+		ID:      0,
+		Name:    "Connect",
+		MaxSize: ConnectMaxSize,
+		Decode:  DecodeConnect,
+		Encode:  EncodeConnect,
+		New:     func() Packet { return &Connect{} },
+		DecodeInto: func(packet Packet, payload []byte) error {
+			return DecodeConnectInto(packet.(*Connect), payload)
+		},
+		Acquire: func() Packet { return AcquireConnect() },
+		Release: func(packet Packet) { ReleaseConnect(packet.(*Connect)) },
+	},
+	{
+		ID:      1,
+		Name:    "Disconnect",
+		MaxSize: DisconnectMaxSize,
+		Decode:  DecodeDisconnect,
+		Encode:  EncodeDisconnect,
+		New:     func() Packet { return &Disconnect{} },
+		DecodeInto: func(packet Packet, payload []byte) error {
+			return DecodeDisconnectInto(packet.(*Disconnect), payload)
+		},
+		Acquire: func() Packet { return AcquireDisconnect() },
+		Release: func(packet Packet) { ReleaseDisconnect(packet.(*Disconnect)) },
+	},
+	{
+		ID:      2,
+		Name:    "Ping",
+		MaxSize: PingMaxSize,
+		Decode:  DecodePing,
+		Encode:  EncodePing,
+		New:     func() Packet { return &Ping{} },
+		DecodeInto: func(packet Packet, payload []byte) error {
+			return DecodePingInto(packet.(*Ping), payload)
+		},
+		Acquire: func() Packet { return AcquirePing() },
+		Release: func(packet Packet) { ReleasePing(packet.(*Ping)) },
+	},
+	{
+		ID:      3,
+		Name:    "Pong",
+		MaxSize: PongMaxSize,
+		Decode:  DecodePong,
+		Encode:  EncodePong,
+		New:     func() Packet { return &Pong{} },
+		DecodeInto: func(packet Packet, payload []byte) error {
+			return DecodePongInto(packet.(*Pong), payload)
+		},
+		Acquire: func() Packet { return AcquirePong() },
+		Release: func(packet Packet) { ReleasePong(packet.(*Pong)) },
+	},
+}
@@ -1,3 +1,3 @@
 package protocol
 
-//go:generate go run ../../tools/protogen/protogen.go -i ../../api/protocol -o ./
+//go:generate go run ../../tools/protogen -i ../../api/protocol -o ./ --decode-into
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+)
+
+type Decoder func(payload []byte) (Packet, error)
+
+// Encoder appends the payload of packet (without the length and ID header)
+// to buf.
+type Encoder func(buf []byte, packet Packet) ([]byte, error)
+
+// PacketInfo describes a packet known to the generated registry.
+type PacketInfo struct {
+	ID   uint32
+	Name string
+	// MaxSize is the largest payload a valid packet can have, so frames
+	// announcing more can be refused before reading them.
+	MaxSize int
+	Decode  Decoder
+	Encode  Encoder
+	New     func() Packet
+
+	// Since and Until bound the versions the packet exists in, from Since
+	// up to but not including Until, 0 meaning open.
+	Since      int
+	Until      int
+	Deprecated bool
+	// Unreliable packets are sent as QUIC datagrams when the client
+	// supports them, and may be lost or arrive out of order.
+	Unreliable bool
+	// DecodeVersion is only set for packets whose layout changes between
+	// versions, Decode reads their newest layout.
+	DecodeVersion func(version int, payload []byte) (Packet, error)
+
+	// Only set when generated with --decode-into.
+	DecodeInto func(packet Packet, payload []byte) error
+	Acquire    func() Packet
+	Release    func(packet Packet)
+}
+
+var (
+	packetsByID   = map[uint32]*PacketInfo{}
+	packetsByName = map[string]*PacketInfo{}
+)
+
+func init() {
+	for i := range packetRegistry {
+		info := &packetRegistry[i]
+		packetsByID[info.ID] = info
+		packetsByName[info.Name] = info
+	}
+}
+
+// LookupID returns a copy of the registered packet with id, changing it
+// does not change the registry.
+func LookupID(id uint32) (PacketInfo, bool) {
+	if info, ok := packetsByID[id]; ok {
+		return *info, true
+	}
+	return PacketInfo{}, false
+}
+
+// LookupName is LookupID by schema name.
+func LookupName(name string) (PacketInfo, bool) {
+	if info, ok := packetsByName[name]; ok {
+		return *info, true
+	}
+	return PacketInfo{}, false
+}
+
+// Packets returns every registered packet, in schema order.
+func Packets() []PacketInfo {
+	return slices.Clone(packetRegistry)
+}
+
+// PacketName returns the schema name of a packet ID, for logging.
+func PacketName(id uint32) string {
+	if info, ok := packetsByID[id]; ok {
+		return info.Name
+	}
+	return fmt.Sprintf("Unknown(%d)", id)
+}
+
+func DecodeByID(id uint32, payload []byte) (Packet, error) {
+	info, ok := packetsByID[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet id %d", id)
+	}
+	return info.Decode(payload)
+}
+
+// DecodeByIDVersion decodes a packet sent by a peer speaking version,
+// refusing packets that do not exist in it.
+func DecodeByIDVersion(version int, id uint32, payload []byte) (Packet, error) {
+	info, ok := packetsByID[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet id %d", id)
+	}
+	if !info.InVersion(version) {
+		return nil, fmt.Errorf("packet %s does not exist in version %d", info.Name, version)
+	}
+	if info.DecodeVersion != nil {
+		return info.DecodeVersion(version, payload)
+	}
+	return info.Decode(payload)
+}
+
+// InVersion reports whether the packet exists in version.
+func (info *PacketInfo) InVersion(version int) bool {
+	if info.Since != 0 && version < info.Since {
+		return false
+	}
+	return info.Until == 0 || version < info.Until
+}
+
+// DecodePooled decodes into a packet taken from the packet's pool. The
+// result aliases payload and should be handed back with Release once it is
+// no longer used.
+func DecodePooled(id uint32, payload []byte) (Packet, error) {
+	info, ok := packetsByID[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet id %d", id)
+	}
+	if info.DecodeInto == nil {
+		return info.Decode(payload)
+	}
+
+	packet := info.Acquire()
+	if err := info.DecodeInto(packet, payload); err != nil {
+		info.Release(packet)
+		return nil, err
+	}
+	return packet, nil
+}
+
+// Release returns a packet obtained from DecodePooled to its pool.
+func Release(packet Packet) {
+	if info, ok := packetsByID[packet.ID()]; ok && info.Release != nil {
+		info.Release(packet)
+	}
+}
+
+// Encode appends the payload of packet to buf using its generated encoder.
+func Encode(buf []byte, packet Packet) ([]byte, error) {
+	info, ok := packetsByID[packet.ID()]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet id %d", packet.ID())
+	}
+	return info.Encode(buf, packet)
+}
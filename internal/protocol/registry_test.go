@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestConnectRoundTrip(t *testing.T) {
+	language := "en-GB"
+	referral := []byte{1, 2, 3}
+	packet := &Connect{
+		ProtocolHash:   strings.Repeat("f", 64),
+		ClientType:     EDITOR,
+		UUID:           uuid.MustParse("0b8e8a4b-6f1e-4c2a-9d53-5d7ae1d6c3f0"),
+		Language:       &language,
+		Username:       "Steve",
+		ReferralData:   &referral,
+		ReferralSource: &HostAddress{Port: 5520, Hostname: "play.example.com"},
+	}
+
+	payload, err := Encode(nil, packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeByID(packet.ID(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, packet) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", decoded, packet)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	info, ok := LookupName("Connect")
+	if !ok || info.ID != 0 {
+		t.Fatalf("LookupName(Connect) = %+v, %v", info, ok)
+	}
+	if _, ok := info.New().(*Connect); !ok {
+		t.Fatalf("New() returned %T", info.New())
+	}
+	if name := PacketName(0); name != "Connect" {
+		t.Fatalf("PacketName(0) = %s", name)
+	}
+	if _, ok := LookupID(0xFFFF); ok {
+		t.Fatal("LookupID found an unregistered packet")
+	}
+
+	info.Unreliable = true
+	if info, _ := LookupID(0); info.Unreliable {
+		t.Fatal("changing a looked up packet changed the registry")
+	}
+}
+
+func TestConnectDefaultLanguage(t *testing.T) {
+	language := "en-US"
+	packet := &Connect{
+		ProtocolHash: strings.Repeat("f", 64),
+		Language:     &language,
+		Username:     "Steve",
+	}
+
+	payload, err := Encode(nil, packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload[0]&0x01 != 0 {
+		t.Fatal("language equal to its default was encoded")
+	}
+
+	decoded, err := DecodeByID(packet.ID(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect := decoded.(*Connect)
+	if connect.Language != nil {
+		t.Fatalf("Language = %q, want absent", *connect.Language)
+	}
+	if got := connect.GetLanguage(); got != "en-US" {
+		t.Fatalf("GetLanguage() = %q, want en-US", got)
+	}
+}
@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	MaxVarIntLen  = 5
+	MaxVarLongLen = 10
+)
+
+var (
+	ErrVarIntTooLong      = errors.New("varint longer than maximum length")
+	ErrVarIntOverflow     = errors.New("varint overflows its type")
+	ErrVarIntNonCanonical = errors.New("varint is not minimally encoded")
+)
+
+// ReadVarInt reads a 32-bit LEB128 varint. Negative values are encoded as
+// their unsigned 32-bit representation, so they always take 5 bytes.
+func ReadVarInt(data []byte, pos int) (value int, size int, _ error) {
+	v, size, err := readUvarint(data, pos, MaxVarIntLen, 32)
+	if err != nil {
+		return 0, size, err
+	}
+	return int(int32(uint32(v))), size, nil
+}
+
+// ReadVarLong reads a 64-bit LEB128 varint.
+func ReadVarLong(data []byte, pos int) (int64, int, error) {
+	v, size, err := readUvarint(data, pos, MaxVarLongLen, 64)
+	if err != nil {
+		return 0, size, err
+	}
+	return int64(v), size, nil
+}
+
+// ReadSVarInt reads a zigzag encoded 32-bit varint, which keeps small
+// negative numbers short.
+func ReadSVarInt(data []byte, pos int) (int32, int, error) {
+	v, size, err := readUvarint(data, pos, MaxVarIntLen, 32)
+	if err != nil {
+		return 0, size, err
+	}
+	u := uint32(v)
+	return int32(u>>1) ^ -int32(u&1), size, nil
+}
+
+func readUvarint(data []byte, pos int, maxLen int, bits uint) (uint64, int, error) {
+	if pos < 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+
+	var value uint64
+	for i := 0; i < maxLen; i++ {
+		if pos+i >= len(data) {
+			return 0, i, io.ErrUnexpectedEOF
+		}
+
+		b := data[pos+i]
+		value |= uint64(b&0x7F) << (7 * uint(i))
+
+		if b&0x80 == 0 {
+			if i > 0 && b == 0 {
+				return 0, i + 1, ErrVarIntNonCanonical
+			}
+			if i == maxLen-1 && b>>(bits-7*uint(maxLen-1)) != 0 {
+				return 0, i + 1, ErrVarIntOverflow
+			}
+			return value, i + 1, nil
+		}
+	}
+
+	return 0, maxLen, ErrVarIntTooLong
+}
+
+func AppendVarInt(buf []byte, v int32) []byte {
+	return appendUvarint(buf, uint64(uint32(v)))
+}
+
+func AppendVarLong(buf []byte, v int64) []byte {
+	return appendUvarint(buf, uint64(v))
+}
+
+func AppendSVarInt(buf []byte, v int32) []byte {
+	return appendUvarint(buf, uint64(uint32(v<<1)^uint32(v>>31)))
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// VarIntSize returns the number of bytes AppendVarInt writes for v.
+func VarIntSize(v int32) int {
+	u := uint32(v)
+	size := 1
+	for u >= 0x80 {
+		u >>= 7
+		size++
+	}
+	return size
+}
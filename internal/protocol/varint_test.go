@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestReadVarInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		value int
+		size  int
+		err   error
+	}{
+		{"zero", []byte{0x00}, 0, 1, nil},
+		{"one byte", []byte{0x7F}, 127, 1, nil},
+		{"two bytes", []byte{0x80, 0x01}, 128, 2, nil},
+		{"max int32", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}, math.MaxInt32, 5, nil},
+		{"negative one", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}, -1, 5, nil},
+		{"min int32", []byte{0x80, 0x80, 0x80, 0x80, 0x08}, math.MinInt32, 5, nil},
+		{"empty", []byte{}, 0, 0, io.ErrUnexpectedEOF},
+		{"truncated", []byte{0x80, 0x80}, 0, 2, io.ErrUnexpectedEOF},
+		{"too long", []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, 0, 5, ErrVarIntTooLong},
+		{"overflow", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x1F}, 0, 5, ErrVarIntOverflow},
+		{"non canonical", []byte{0x81, 0x00}, 0, 2, ErrVarIntNonCanonical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, size, err := ReadVarInt(tt.data, 0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if value != tt.value || size != tt.size {
+				t.Fatalf("got (%d, %d), want (%d, %d)", value, size, tt.value, tt.size)
+			}
+		})
+	}
+}
+
+func TestReadVarLongOverflow(t *testing.T) {
+	data := bytes.Repeat([]byte{0xFF}, 9)
+	if _, _, err := ReadVarLong(append(data, 0x01), 0); err != nil {
+		t.Fatalf("max uint64 encoding: %v", err)
+	}
+	if _, _, err := ReadVarLong(append(data, 0x02), 0); !errors.Is(err, ErrVarIntOverflow) {
+		t.Fatalf("err = %v, want %v", err, ErrVarIntOverflow)
+	}
+}
+
+func TestSVarIntSmallNegatives(t *testing.T) {
+	for v, want := range map[int32][]byte{0: {0x00}, -1: {0x01}, 1: {0x02}, -2: {0x03}, math.MinInt32: {0xFF, 0xFF, 0xFF, 0xFF, 0x0F}} {
+		if got := AppendSVarInt(nil, v); !bytes.Equal(got, want) {
+			t.Errorf("AppendSVarInt(%d) = % x, want % x", v, got, want)
+		}
+	}
+}
+
+func FuzzVarIntRoundTrip(f *testing.F) {
+	for _, seed := range []int32{0, 1, -1, 127, 128, math.MaxInt32, math.MinInt32} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, v int32) {
+		buf := AppendVarInt(nil, v)
+		if len(buf) != VarIntSize(v) {
+			t.Fatalf("VarIntSize(%d) = %d, encoded %d bytes", v, VarIntSize(v), len(buf))
+		}
+		got, size, err := ReadVarInt(buf, 0)
+		if err != nil || int32(got) != v || size != len(buf) {
+			t.Fatalf("ReadVarInt(% x) = (%d, %d, %v), want %d", buf, got, size, err, v)
+		}
+
+		zz := AppendSVarInt(nil, v)
+		sgot, ssize, err := ReadSVarInt(zz, 0)
+		if err != nil || sgot != v || ssize != len(zz) {
+			t.Fatalf("ReadSVarInt(% x) = (%d, %d, %v), want %d", zz, sgot, ssize, err, v)
+		}
+	})
+}
+
+func FuzzVarLongRoundTrip(f *testing.F) {
+	for _, seed := range []int64{0, 1, -1, math.MaxInt64, math.MinInt64} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, v int64) {
+		buf := AppendVarLong(nil, v)
+		got, size, err := ReadVarLong(buf, 0)
+		if err != nil || got != v || size != len(buf) {
+			t.Fatalf("ReadVarLong(% x) = (%d, %d, %v), want %d", buf, got, size, err, v)
+		}
+	})
+}
+
+// Any input the decoder accepts must re-encode to exactly the bytes it
+// consumed, otherwise two encodings would map to the same value.
+func FuzzReadVarInt(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x80, 0x01})
+	f.Add([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F})
+	f.Add([]byte{0x80, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, size, err := ReadVarInt(data, 0)
+		if err != nil {
+			return
+		}
+		if encoded := AppendVarInt(nil, int32(v)); !bytes.Equal(encoded, data[:size]) {
+			t.Fatalf("decoded % x as %d, which encodes as % x", data[:size], v, encoded)
+		}
+	})
+}
+
+func FuzzReadVarLong(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add(bytes.Repeat([]byte{0xFF}, 10))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, size, err := ReadVarLong(data, 0)
+		if err != nil {
+			return
+		}
+		if encoded := AppendVarLong(nil, v); !bytes.Equal(encoded, data[:size]) {
+			t.Fatalf("decoded % x as %d, which encodes as % x", data[:size], v, encoded)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+type Vec2f struct {
+	X, Y float32
+}
+
+type Vec3f struct {
+	X, Y, Z float32
+}
+
+type Vec3d struct {
+	X, Y, Z float64
+}
+
+type Vec3i struct {
+	X, Y, Z int32
+}
+
+// Quatf is a rotation quaternion, encoded as x, y, z, w.
+type Quatf struct {
+	X, Y, Z, W float32
+}
+
+func (v Vec2f) Add(o Vec2f) Vec2f        { return Vec2f{v.X + o.X, v.Y + o.Y} }
+func (v Vec2f) Sub(o Vec2f) Vec2f        { return Vec2f{v.X - o.X, v.Y - o.Y} }
+func (v Vec2f) Scale(s float32) Vec2f    { return Vec2f{v.X * s, v.Y * s} }
+func (v Vec2f) Dot(o Vec2f) float32      { return v.X*o.X + v.Y*o.Y }
+func (v Vec2f) Length() float32          { return float32(math.Sqrt(float64(v.Dot(v)))) }
+func (v Vec2f) Distance(o Vec2f) float32 { return v.Sub(o).Length() }
+
+func (v Vec2f) Normalize() Vec2f {
+	l := v.Length()
+	if l == 0 {
+		return v
+	}
+	return v.Scale(1 / l)
+}
+
+func (v Vec3f) Add(o Vec3f) Vec3f        { return Vec3f{v.X + o.X, v.Y + o.Y, v.Z + o.Z} }
+func (v Vec3f) Sub(o Vec3f) Vec3f        { return Vec3f{v.X - o.X, v.Y - o.Y, v.Z - o.Z} }
+func (v Vec3f) Scale(s float32) Vec3f    { return Vec3f{v.X * s, v.Y * s, v.Z * s} }
+func (v Vec3f) Dot(o Vec3f) float32      { return v.X*o.X + v.Y*o.Y + v.Z*o.Z }
+func (v Vec3f) Length() float32          { return float32(math.Sqrt(float64(v.Dot(v)))) }
+func (v Vec3f) Distance(o Vec3f) float32 { return v.Sub(o).Length() }
+func (v Vec3f) ToVec3d() Vec3d           { return Vec3d{float64(v.X), float64(v.Y), float64(v.Z)} }
+
+func (v Vec3f) Cross(o Vec3f) Vec3f {
+	return Vec3f{
+		v.Y*o.Z - v.Z*o.Y,
+		v.Z*o.X - v.X*o.Z,
+		v.X*o.Y - v.Y*o.X,
+	}
+}
+
+func (v Vec3f) Normalize() Vec3f {
+	l := v.Length()
+	if l == 0 {
+		return v
+	}
+	return v.Scale(1 / l)
+}
+
+func (v Vec3f) Lerp(o Vec3f, t float32) Vec3f {
+	return v.Add(o.Sub(v).Scale(t))
+}
+
+func (v Vec3d) Add(o Vec3d) Vec3d        { return Vec3d{v.X + o.X, v.Y + o.Y, v.Z + o.Z} }
+func (v Vec3d) Sub(o Vec3d) Vec3d        { return Vec3d{v.X - o.X, v.Y - o.Y, v.Z - o.Z} }
+func (v Vec3d) Scale(s float64) Vec3d    { return Vec3d{v.X * s, v.Y * s, v.Z * s} }
+func (v Vec3d) Dot(o Vec3d) float64      { return v.X*o.X + v.Y*o.Y + v.Z*o.Z }
+func (v Vec3d) Length() float64          { return math.Sqrt(v.Dot(v)) }
+func (v Vec3d) Distance(o Vec3d) float64 { return v.Sub(o).Length() }
+func (v Vec3d) ToVec3f() Vec3f           { return Vec3f{float32(v.X), float32(v.Y), float32(v.Z)} }
+
+func (v Vec3d) Cross(o Vec3d) Vec3d {
+	return Vec3d{
+		v.Y*o.Z - v.Z*o.Y,
+		v.Z*o.X - v.X*o.Z,
+		v.X*o.Y - v.Y*o.X,
+	}
+}
+
+func (v Vec3d) Normalize() Vec3d {
+	l := v.Length()
+	if l == 0 {
+		return v
+	}
+	return v.Scale(1 / l)
+}
+
+func (v Vec3d) Lerp(o Vec3d, t float64) Vec3d {
+	return v.Add(o.Sub(v).Scale(t))
+}
+
+// Floor returns the integer (block) position containing v.
+func (v Vec3d) Floor() Vec3i {
+	return Vec3i{int32(math.Floor(v.X)), int32(math.Floor(v.Y)), int32(math.Floor(v.Z))}
+}
+
+func (v Vec3i) Add(o Vec3i) Vec3i      { return Vec3i{v.X + o.X, v.Y + o.Y, v.Z + o.Z} }
+func (v Vec3i) Sub(o Vec3i) Vec3i      { return Vec3i{v.X - o.X, v.Y - o.Y, v.Z - o.Z} }
+func (v Vec3i) Scale(s int32) Vec3i    { return Vec3i{v.X * s, v.Y * s, v.Z * s} }
+func (v Vec3i) Dot(o Vec3i) int32      { return v.X*o.X + v.Y*o.Y + v.Z*o.Z }
+func (v Vec3i) ToVec3d() Vec3d         { return Vec3d{float64(v.X), float64(v.Y), float64(v.Z)} }
+func (v Vec3i) ManhattanLength() int32 { return abs32(v.X) + abs32(v.Y) + abs32(v.Z) }
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func QuatIdentity() Quatf {
+	return Quatf{W: 1}
+}
+
+// QuatFromAxisAngle returns the rotation of angle radians around axis.
+func QuatFromAxisAngle(axis Vec3f, angle float32) Quatf {
+	axis = axis.Normalize()
+	s := float32(math.Sin(float64(angle) / 2))
+	return Quatf{axis.X * s, axis.Y * s, axis.Z * s, float32(math.Cos(float64(angle) / 2))}
+}
+
+// Mul returns q * o, which applies the rotation o and then q.
+func (q Quatf) Mul(o Quatf) Quatf {
+	return Quatf{
+		q.W*o.X + q.X*o.W + q.Y*o.Z - q.Z*o.Y,
+		q.W*o.Y - q.X*o.Z + q.Y*o.W + q.Z*o.X,
+		q.W*o.Z + q.X*o.Y - q.Y*o.X + q.Z*o.W,
+		q.W*o.W - q.X*o.X - q.Y*o.Y - q.Z*o.Z,
+	}
+}
+
+func (q Quatf) Conjugate() Quatf {
+	return Quatf{-q.X, -q.Y, -q.Z, q.W}
+}
+
+func (q Quatf) Length() float32 {
+	return float32(math.Sqrt(float64(q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W)))
+}
+
+func (q Quatf) Normalize() Quatf {
+	l := q.Length()
+	if l == 0 {
+		return QuatIdentity()
+	}
+	return Quatf{q.X / l, q.Y / l, q.Z / l, q.W / l}
+}
+
+// Rotate applies the rotation q to v. q is expected to be normalised.
+func (q Quatf) Rotate(v Vec3f) Vec3f {
+	u := Vec3f{q.X, q.Y, q.Z}
+	t := u.Cross(v).Scale(2)
+	return v.Add(t.Scale(q.W)).Add(u.Cross(t))
+}
+
+func ReadVec2f(payload []byte, pos int) (Vec2f, int, error) {
+	if pos < 0 || pos+8 > len(payload) {
+		return Vec2f{}, 0, io.ErrUnexpectedEOF
+	}
+	return Vec2f{readFloat32(payload, pos), readFloat32(payload, pos+4)}, 8, nil
+}
+
+func ReadVec3f(payload []byte, pos int) (Vec3f, int, error) {
+	if pos < 0 || pos+12 > len(payload) {
+		return Vec3f{}, 0, io.ErrUnexpectedEOF
+	}
+	return Vec3f{readFloat32(payload, pos), readFloat32(payload, pos+4), readFloat32(payload, pos+8)}, 12, nil
+}
+
+func ReadVec3d(payload []byte, pos int) (Vec3d, int, error) {
+	if pos < 0 || pos+24 > len(payload) {
+		return Vec3d{}, 0, io.ErrUnexpectedEOF
+	}
+	return Vec3d{readFloat64(payload, pos), readFloat64(payload, pos+8), readFloat64(payload, pos+16)}, 24, nil
+}
+
+func ReadVec3i(payload []byte, pos int) (Vec3i, int, error) {
+	if pos < 0 || pos+12 > len(payload) {
+		return Vec3i{}, 0, io.ErrUnexpectedEOF
+	}
+	return Vec3i{
+		int32(binary.LittleEndian.Uint32(payload[pos:])),
+		int32(binary.LittleEndian.Uint32(payload[pos+4:])),
+		int32(binary.LittleEndian.Uint32(payload[pos+8:])),
+	}, 12, nil
+}
+
+func ReadQuatf(payload []byte, pos int) (Quatf, int, error) {
+	if pos < 0 || pos+16 > len(payload) {
+		return Quatf{}, 0, io.ErrUnexpectedEOF
+	}
+	return Quatf{
+		readFloat32(payload, pos),
+		readFloat32(payload, pos+4),
+		readFloat32(payload, pos+8),
+		readFloat32(payload, pos+12),
+	}, 16, nil
+}
+
+func AppendVec2f(buf []byte, v Vec2f) []byte {
+	return appendFloat32(appendFloat32(buf, v.X), v.Y)
+}
+
+func AppendVec3f(buf []byte, v Vec3f) []byte {
+	return appendFloat32(appendFloat32(appendFloat32(buf, v.X), v.Y), v.Z)
+}
+
+func AppendVec3d(buf []byte, v Vec3d) []byte {
+	return appendFloat64(appendFloat64(appendFloat64(buf, v.X), v.Y), v.Z)
+}
+
+func AppendVec3i(buf []byte, v Vec3i) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(v.X))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(v.Y))
+	return binary.LittleEndian.AppendUint32(buf, uint32(v.Z))
+}
+
+func AppendQuatf(buf []byte, q Quatf) []byte {
+	return appendFloat32(appendFloat32(appendFloat32(appendFloat32(buf, q.X), q.Y), q.Z), q.W)
+}
+
+func readFloat32(payload []byte, pos int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(payload[pos:]))
+}
+
+func readFloat64(payload []byte, pos int) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(payload[pos:]))
+}
+
+func appendFloat32(buf []byte, f float32) []byte {
+	return binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+}
+
+func appendFloat64(buf []byte, f float64) []byte {
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+}
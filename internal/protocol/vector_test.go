@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b Vec3f) bool {
+	const eps = 1e-5
+	return math.Abs(float64(a.X-b.X)) < eps && math.Abs(float64(a.Y-b.Y)) < eps && math.Abs(float64(a.Z-b.Z)) < eps
+}
+
+func TestQuatRotate(t *testing.T) {
+	q := QuatFromAxisAngle(Vec3f{Y: 1}, math.Pi/2)
+
+	got := q.Rotate(Vec3f{X: 1})
+	if want := (Vec3f{Z: -1}); !approxEqual(got, want) {
+		t.Fatalf("Rotate = %v, want %v", got, want)
+	}
+
+	full := q.Mul(q).Mul(q).Mul(q)
+	if got := full.Rotate(Vec3f{1, 2, 3}); !approxEqual(got, Vec3f{1, 2, 3}) {
+		t.Fatalf("four quarter turns = %v, want identity", got)
+	}
+}
+
+func TestVectorRoundTrip(t *testing.T) {
+	buf := AppendVec3d(nil, Vec3d{1.5, -64, 1e9})
+	buf = AppendQuatf(buf, Quatf{0.1, 0.2, 0.3, 0.9})
+	buf = AppendVec3i(buf, Vec3i{-1, 0, math.MaxInt32})
+
+	v, n, err := ReadVec3d(buf, 0)
+	if err != nil || n != 24 || v != (Vec3d{1.5, -64, 1e9}) {
+		t.Fatalf("ReadVec3d = (%v, %d, %v)", v, n, err)
+	}
+	q, n, err := ReadQuatf(buf, 24)
+	if err != nil || n != 16 || q != (Quatf{0.1, 0.2, 0.3, 0.9}) {
+		t.Fatalf("ReadQuatf = (%v, %d, %v)", q, n, err)
+	}
+	i, n, err := ReadVec3i(buf, 40)
+	if err != nil || n != 12 || i != (Vec3i{-1, 0, math.MaxInt32}) {
+		t.Fatalf("ReadVec3i = (%v, %d, %v)", i, n, err)
+	}
+	if _, _, err := ReadVec3i(buf, 41); err == nil {
+		t.Fatal("expected error reading past end of payload")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"hygoal/tools/protogen/internal"
+	"hygoal/tools/protogen/internal/javaimport"
+	"os"
+)
+
+type ImportJavaCmd struct {
+	Paths  []string `arg:"" help:"Java source files, or directories to search for them." type:"path"`
+	Output string   `help:"Schema file to write. Printed to stdout when omitted." short:"o" type:"path"`
+}
+
+func (c *ImportJavaCmd) Run() error {
+	sources, err := javaimport.LoadSources(c.Paths)
+	if err != nil {
+		return err
+	}
+
+	file, warnings := javaimport.Import(sources)
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+
+	schema := protogen.FormatSchema(file)
+	if c.Output == "" {
+		fmt.Print(schema)
+		return nil
+	}
+
+	return os.WriteFile(c.Output, []byte(schema), 0644)
+}
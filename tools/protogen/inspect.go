@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hygoal/tools/protogen/internal/interp"
+	"io"
+	"os"
+	"strings"
+)
+
+type InspectCmd struct {
+	Input   string `help:"Input directory containing .schema files." short:"i" required:"" type:"path"`
+	ID      uint32 `help:"Packet ID of the payload." required:""`
+	Version int    `help:"Protocol version the payload was sent with. The newest layout when negative." default:"-1"`
+	Hex     string `arg:"" optional:"" help:"Hex dump of the payload. Read from stdin when omitted."`
+}
+
+func (c *InspectCmd) Run() error {
+	in, err := interp.Load(c.Input)
+	if err != nil {
+		return err
+	}
+
+	dump := c.Hex
+	if dump == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		dump = string(data)
+	}
+
+	payload, err := parseHexDump(dump)
+	if err != nil {
+		return err
+	}
+
+	var obj *interp.Object
+	if c.Version < 0 {
+		obj, err = in.Decode(c.ID, payload)
+	} else {
+		obj, err = in.DecodeVersion(c.Version, c.ID, payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(obj)
+
+	return nil
+}
+
+// parseHexDump accepts plain hex with any whitespace, optionally prefixed
+// with 0x, so dumps can be pasted straight from a debugger or Wireshark.
+func parseHexDump(dump string) ([]byte, error) {
+	dump = strings.TrimPrefix(strings.TrimSpace(dump), "0x")
+	dump = strings.Join(strings.Fields(dump), "")
+	return hex.DecodeString(dump)
+}
@@ -88,6 +88,10 @@ type PacketNode struct {
 	Name   string
 	ID     uint32
 	Fields []FieldNode
+	// Unreliable packets are sent as QUIC datagrams, which may be lost or
+	// arrive out of order.
+	Unreliable bool
+	Versions
 }
 
 func (p *PacketNode) isNode() bool {
@@ -109,12 +113,46 @@ type FieldNode struct {
 	//Repeated bool
 	Optional bool
 	Fixed    bool
+	// Default is used in place of an absent optional field.
+	Default *LiteralNode
+	Versions
 }
 
 func (f *FieldNode) isNode() bool {
 	return true
 }
 
+// Versions holds the @since, @until and deprecated annotations of a field
+// or packet. It is present from Since up to, but not including, Until; a
+// nil bound is open.
+type Versions struct {
+	Since      *int
+	Until      *int
+	Deprecated bool
+}
+
+// Includes reports whether the annotated item exists in version.
+func (v Versions) Includes(version int) bool {
+	if v.Since != nil && version < *v.Since {
+		return false
+	}
+	if v.Until != nil && version >= *v.Until {
+		return false
+	}
+	return true
+}
+
+// LiteralNode is a constant in the schema, such as a field default. Type is
+// TokenString, TokenNumber or TokenIdent (an enum value, true or false).
+type LiteralNode struct {
+	Type  TokenType
+	Value string
+}
+
+func (l *LiteralNode) isNode() bool {
+	return true
+}
+
 type FieldTypeNode struct {
 	Name    string
 	MinSize *int // if min is null, size is fixed to MaxSize
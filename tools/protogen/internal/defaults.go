@@ -0,0 +1,69 @@
+package protogen
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// defaultLiteral returns the Go expression for a field's default, checking
+// that the literal suits the field's type.
+func defaultLiteral(file *FileNode, field *FieldNode) (string, error) {
+	literal := field.Default
+
+	switch field.Type.Name {
+	case "ascii", "utf8", "string":
+		if literal.Type != TokenString {
+			return "", fmt.Errorf("default of %s must be a string", field.Name)
+		}
+		if field.Type.MaxSize != nil && len(literal.Value) > *field.Type.MaxSize {
+			return "", fmt.Errorf("default of %s is longer than %d", field.Name, *field.Type.MaxSize)
+		}
+		return strconv.Quote(literal.Value), nil
+	case "varint", "svarint", "varlong", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64":
+		if literal.Type != TokenNumber {
+			return "", fmt.Errorf("default of %s must be a number", field.Name)
+		}
+		return literal.Value, nil
+	}
+
+	if enum := file.FindEnum(field.Type.Name); enum != nil {
+		if literal.Type != TokenIdent {
+			return "", fmt.Errorf("default of %s must be a %s value", field.Name, enum.Name)
+		}
+		for _, value := range enum.Values {
+			if value.Name == literal.Value {
+				return value.Name, nil
+			}
+		}
+		return "", fmt.Errorf("default of %s: %s is not a %s value", field.Name, literal.Value, enum.Name)
+	}
+
+	return "", fmt.Errorf("field %s of type %s cannot have a default", field.Name, field.Type.Name)
+}
+
+func generateGetterCode(file *FileNode, packet *PacketNode) (string, error) {
+	code := ""
+
+	for i := range packet.Fields {
+		field := &packet.Fields[i]
+		if field.Default == nil {
+			continue
+		}
+
+		literal, err := defaultLiteral(file, field)
+		if err != nil {
+			return "", err
+		}
+
+		fieldName := capitalize(field.Name)
+		code += "// Get" + fieldName + " returns " + fieldName + ", or " + literal + " when it is absent.\n"
+		code += "func (p *" + packet.Name + ") Get" + fieldName + "() " + mapFieldTypeToGoType(field.Type) + " {\n"
+		code += "\tif p." + fieldName + " == nil {\n"
+		code += "\t\treturn " + literal + "\n"
+		code += "\t}\n"
+		code += "\treturn *p." + fieldName + "\n"
+		code += "}\n\n"
+	}
+
+	return code, nil
+}
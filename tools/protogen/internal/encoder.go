@@ -0,0 +1,151 @@
+package protogen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+type EncodeData struct {
+	Packet          *PacketNode
+	FixedBody       string
+	VariableBody    string
+	OffsetTableSize int
+	NeedsErr        bool
+}
+
+// varIntWriters maps the varint schema types to their writer in the
+// protocol package.
+var varIntWriters = map[string]string{
+	"varint":  "AppendVarInt",
+	"varlong": "AppendVarLong",
+	"svarint": "AppendSVarInt",
+}
+
+func generateEncoderCode(file *FileNode, packet *PacketNode) (string, error) {
+	layout, err := ComputeLayout(file, packet)
+	if err != nil {
+		return "", fmt.Errorf("packet %s: %w", packet.Name, err)
+	}
+
+	data := EncodeData{
+		Packet:          packet,
+		OffsetTableSize: 4 * len(layout.Variable),
+	}
+
+	fixedBuf := bytes.NewBufferString("")
+	for _, fl := range layout.Fixed {
+		value := "packet." + capitalize(fl.Field.Name)
+		if fl.Field.Optional {
+			return "", fmt.Errorf("fixed field %s cannot be optional", fl.Field.Name)
+		}
+
+		code, fallible, err := writeFieldEncoder(file, fl.Field, value)
+		if err != nil {
+			return "", err
+		}
+		data.NeedsErr = data.NeedsErr || fallible
+
+		fixedBuf.WriteString("\n// Field " + fl.Field.Name + "\n")
+		fixedBuf.WriteString(code)
+	}
+	data.FixedBody = fixedBuf.String()
+
+	variableBuf := bytes.NewBufferString("")
+	for _, fl := range layout.Variable {
+		value := "packet." + capitalize(fl.Field.Name)
+		slot := "start+" + strconv.Itoa(fl.Offset)
+
+		variableBuf.WriteString("\n// Field " + fl.Field.Name + "\n")
+
+		if fl.Field.Optional {
+			code, fallible, err := writeFieldEncoder(file, fl.Field, "(*"+value+")")
+			if err != nil {
+				return "", err
+			}
+			data.NeedsErr = data.NeedsErr || fallible
+
+			// a value equal to the default is left out, the decoder's
+			// Get accessor gives it back
+			condition := value + " != nil"
+			if fl.Field.Default != nil {
+				literal, err := defaultLiteral(file, fl.Field)
+				if err != nil {
+					return "", err
+				}
+				condition += " && *" + value + " != " + literal
+			}
+
+			variableBuf.WriteString("if " + condition + " {\n")
+			variableBuf.WriteString("nullBits |= 0x" + fmt.Sprintf("%02X", fl.NullBit) + "\n")
+			variableBuf.WriteString("PutOffset(buf, " + slot + ", len(buf)-varStart)\n")
+			variableBuf.WriteString(code)
+			variableBuf.WriteString("} else {\n")
+			variableBuf.WriteString("PutOffset(buf, " + slot + ", -1)\n")
+			variableBuf.WriteString("}\n")
+		} else {
+			code, fallible, err := writeFieldEncoder(file, fl.Field, value)
+			if err != nil {
+				return "", err
+			}
+			data.NeedsErr = data.NeedsErr || fallible
+
+			variableBuf.WriteString("PutOffset(buf, " + slot + ", len(buf)-varStart)\n")
+			variableBuf.WriteString(code)
+		}
+	}
+	data.VariableBody = variableBuf.String()
+
+	encodeBuf := bytes.NewBufferString("")
+	err = encodeTemplate.Execute(encodeBuf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeBuf.String(), nil
+}
+
+// writeFieldEncoder returns code appending value to buf, and whether that
+// code assigns err.
+func writeFieldEncoder(file *FileNode, field *FieldNode, value string) (string, bool, error) {
+	checkErr := "if err != nil {\n\treturn nil, fmt.Errorf(\"error encoding " + field.Name + ": %w\", err)\n}\n"
+
+	switch field.Type.Name {
+	case "ascii", "utf8", "string":
+		if field.Type.MaxSize == nil {
+			return "", false, fmt.Errorf("string field %s must have a max size", field.Name)
+		}
+		if field.Type.MinSize == nil {
+			return "buf, err = AppendFixedString(buf, " + value + ", " + strconv.Itoa(*field.Type.MaxSize) + ")\n" + checkErr, true, nil
+		}
+		return "buf, err = AppendVarString(buf, " + value + ", " + strconv.Itoa(*field.Type.MaxSize) + ")\n" + checkErr, true, nil
+	case "uuid":
+		return "buf = append(buf, " + value + "[:]...)\n", false, nil
+	case "array.byte":
+		minSize := 0
+		if field.Type.MinSize != nil {
+			minSize = *field.Type.MinSize
+		}
+		if field.Type.MaxSize == nil {
+			return "", false, fmt.Errorf("array field %s must have a max size", field.Name)
+		}
+		return "buf, err = AppendByteArray(buf, " + value + ", " + strconv.Itoa(minSize) + ", " + strconv.Itoa(*field.Type.MaxSize) + ")\n" + checkErr, true, nil
+	}
+
+	if writer, ok := varIntWriters[field.Type.Name]; ok {
+		return "buf = " + writer + "(buf, " + value + ")\n", false, nil
+	}
+
+	if vector, ok := vectorTypes[field.Type.Name]; ok {
+		return "buf = Append" + vector.GoType + "(buf, " + value + ")\n", false, nil
+	}
+
+	switch file.FindAny(field.Type.Name).(type) {
+	case *EnumNode:
+		return "buf = append(buf, byte(" + value + "))\n", false, nil
+	case *TypeNode:
+		return "buf, err = Append" + field.Type.Name + "(buf, " + value + ")\n" + checkErr, true, nil
+	}
+
+	return "", false, fmt.Errorf("field %s has unsupported type %s", field.Name, field.Type.Name)
+}
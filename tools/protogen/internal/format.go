@@ -0,0 +1,101 @@
+package protogen
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FormatSchema prints file back as .schema source, one declaration after
+// another separated by a blank line.
+func FormatSchema(file *FileNode) string {
+	var b strings.Builder
+
+	for i, expr := range file.Expressions {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		switch node := expr.(type) {
+		case *EnumNode:
+			b.WriteString("enum " + node.Name + " {\n")
+			for j, value := range node.Values {
+				b.WriteString("\t" + value.Name)
+				if j < len(node.Values)-1 {
+					b.WriteString(",")
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString("}\n")
+		case *TypeNode:
+			b.WriteString("type " + node.Name + " {\n")
+			formatFields(&b, node.Fields)
+			b.WriteString("}\n")
+		case *PacketNode:
+			annotations := formatAnnotations(node.Versions)
+			if node.Unreliable {
+				annotations = strings.TrimSpace(annotations + " unreliable")
+			}
+			if annotations != "" {
+				b.WriteString(annotations + "\n")
+			}
+			b.WriteString("packet " + strconv.FormatUint(uint64(node.ID), 10) + " " + node.Name + " {\n")
+			formatFields(&b, node.Fields)
+			b.WriteString("}\n")
+		}
+	}
+
+	return b.String()
+}
+
+func formatFields(b *strings.Builder, fields []FieldNode) {
+	for _, field := range fields {
+		b.WriteString("\t")
+		if annotations := formatAnnotations(field.Versions); annotations != "" {
+			b.WriteString(annotations + " ")
+		}
+		if !field.Fixed {
+			b.WriteString("@")
+		}
+		b.WriteString(field.Name)
+		if field.Optional {
+			b.WriteString("?")
+		}
+		b.WriteString(" " + formatFieldType(field.Type))
+		if field.Default != nil {
+			b.WriteString(" = " + formatLiteral(field.Default))
+		}
+		b.WriteString("\n")
+	}
+}
+
+func formatAnnotations(versions Versions) string {
+	var annotations []string
+	if versions.Since != nil {
+		annotations = append(annotations, "@since("+strconv.Itoa(*versions.Since)+")")
+	}
+	if versions.Until != nil {
+		annotations = append(annotations, "@until("+strconv.Itoa(*versions.Until)+")")
+	}
+	if versions.Deprecated {
+		annotations = append(annotations, "deprecated")
+	}
+	return strings.Join(annotations, " ")
+}
+
+func formatFieldType(fieldType FieldTypeNode) string {
+	switch {
+	case fieldType.MaxSize == nil:
+		return fieldType.Name
+	case fieldType.MinSize == nil:
+		return fieldType.Name + "[" + strconv.Itoa(*fieldType.MaxSize) + "]"
+	default:
+		return fieldType.Name + "[" + strconv.Itoa(*fieldType.MinSize) + ":" + strconv.Itoa(*fieldType.MaxSize) + "]"
+	}
+}
+
+func formatLiteral(literal *LiteralNode) string {
+	if literal.Type == TokenString {
+		return "\"" + literal.Value + "\""
+	}
+	return literal.Value
+}
@@ -13,6 +13,9 @@ import (
 var embedFS embed.FS
 
 var decodeTemplate *template.Template
+var decodeIntoTemplate *template.Template
+var encodeTemplate *template.Template
+var registryTemplate *template.Template
 
 var stringsTemplate *template.Template
 var enumTemplate *template.Template
@@ -20,6 +23,8 @@ var uuidTemplate *template.Template
 var arrayTemplate *template.Template
 var byteArrayTemplate *template.Template
 var callTypeTemplate *template.Template
+var varIntTemplate *template.Template
+var vectorTemplate *template.Template
 
 func loadTemplate(name string) *template.Template {
 	templateCode, err := embedFS.ReadFile("templates/" + name + ".gotmpl")
@@ -38,6 +43,7 @@ func loadTemplate(name string) *template.Template {
 			}
 			return string(in[0]+32) + in[1:]
 		},
+		"assign": assignField,
 	}
 
 	tmpl, err := template.New(name).Funcs(funcMap).Parse(string(templateCode))
@@ -50,6 +56,9 @@ func loadTemplate(name string) *template.Template {
 
 func init() {
 	decodeTemplate = loadTemplate("decode_fn")
+	decodeIntoTemplate = loadTemplate("decode_into_fn")
+	encodeTemplate = loadTemplate("encode_fn")
+	registryTemplate = loadTemplate("registry")
 
 	stringsTemplate = loadTemplate("strings")
 	enumTemplate = loadTemplate("enum")
@@ -57,11 +66,24 @@ func init() {
 	arrayTemplate = loadTemplate("array")
 	byteArrayTemplate = loadTemplate("byte_array")
 	callTypeTemplate = loadTemplate("call_decode_type")
+	varIntTemplate = loadTemplate("varint")
+	vectorTemplate = loadTemplate("vector")
 }
 
-func GenerateGoCode(ast *FileNode) (string, error) {
+type GenerateOptions struct {
+	// DecodeInto also generates Decode<Packet>Into functions that reuse a
+	// caller provided struct, and sync.Pool backed Acquire/Release helpers.
+	DecodeInto bool
+}
+
+func GenerateGoCode(ast *FileNode, options GenerateOptions) (string, error) {
 	str := ""
 
+	packets, err := collectPackets(ast)
+	if err != nil {
+		return "", err
+	}
+
 	for _, expr := range ast.Expressions {
 		switch node := expr.(type) {
 		case *EnumNode:
@@ -71,7 +93,7 @@ func GenerateGoCode(ast *FileNode) (string, error) {
 			}
 			str += enumCode
 		case *PacketNode:
-			packetCode, err := generatePacketCode(ast, node)
+			packetCode, err := generatePacketCode(ast, node, options)
 			if err != nil {
 				return "", err
 			}
@@ -85,9 +107,44 @@ func GenerateGoCode(ast *FileNode) (string, error) {
 		}
 	}
 
+	registryBuf := bytes.NewBufferString("")
+	err = registryTemplate.Execute(registryBuf, RegistryData{Packets: newRegistryEntries(packets), DecodeInto: options.DecodeInto})
+	if err != nil {
+		return "", err
+	}
+	str += registryBuf.String()
+
 	return str, nil
 }
 
+// collectPackets returns every packet in the file, failing if two packets
+// share an ID or a name.
+func collectPackets(ast *FileNode) ([]*PacketNode, error) {
+	packets := make([]*PacketNode, 0)
+	byID := map[uint32]*PacketNode{}
+	byName := map[string]*PacketNode{}
+
+	for _, expr := range ast.Expressions {
+		packet, ok := expr.(*PacketNode)
+		if !ok {
+			continue
+		}
+
+		if existing, exists := byID[packet.ID]; exists {
+			return nil, fmt.Errorf("duplicate packet id %d: %s and %s", packet.ID, existing.Name, packet.Name)
+		}
+		if _, exists := byName[packet.Name]; exists {
+			return nil, fmt.Errorf("duplicate packet name %s", packet.Name)
+		}
+
+		byID[packet.ID] = packet
+		byName[packet.Name] = packet
+		packets = append(packets, packet)
+	}
+
+	return packets, nil
+}
+
 func generateEnumCode(enum *EnumNode) (string, error) {
 	code := "type " + enum.Name + " byte\n\n"
 
@@ -116,15 +173,118 @@ type DecodeData struct {
 	Packet           *PacketNode
 	ParsingBody      string
 	SizeOfFixedFrame int
+	// NeedsErr and NeedsNullBits leave out declarations the body does not
+	// use, which Go would reject.
+	NeedsErr      bool
+	NeedsNullBits bool
+	// Suffix is appended to the function name, for per-version decoders.
+	Suffix string
+}
+
+type RegistryData struct {
+	Packets    []RegistryEntry
+	DecodeInto bool
+}
+
+type RegistryEntry struct {
+	*PacketNode
+	// Versioned is set when the packet has a Decode<Packet>Version.
+	Versioned bool
+	// SinceVersion and UntilVersion are the packet's bounds, 0 if open.
+	SinceVersion int
+	UntilVersion int
+}
+
+func newRegistryEntries(packets []*PacketNode) []RegistryEntry {
+	entries := make([]RegistryEntry, len(packets))
+	for i, packet := range packets {
+		entries[i] = RegistryEntry{PacketNode: packet, Versioned: versionRanges(packet) != nil}
+		if packet.Since != nil {
+			entries[i].SinceVersion = *packet.Since
+		}
+		if packet.Until != nil {
+			entries[i].UntilVersion = *packet.Until
+		}
+	}
+	return entries
 }
 
 type FieldData struct {
 	Field  *FieldNode
 	Offset int
+	Reader string
+	GoType string
+	// Into is set when generating Decode<Packet>Into, which returns only an
+	// error and reuses the storage already in packet.
+	Into      bool
+	ErrReturn string
+}
+
+func newFieldData(field *FieldNode, offset int, into bool) FieldData {
+	data := FieldData{Field: field, Offset: offset, Into: into, ErrReturn: "nil, "}
+	if into {
+		data.ErrReturn = ""
+	}
+	return data
 }
 
-func generatePacketCode(file *FileNode, packet *PacketNode) (string, error) {
-	code := "type " + packet.Name + " struct {\n"
+// assignField returns the statement storing value in the packet field.
+// In Into mode optional fields reuse the pointer from a previous decode.
+func assignField(field *FieldNode, into bool, value string) string {
+	target := "packet." + capitalize(field.Name)
+	if !field.Optional {
+		return target + " = " + value
+	}
+	if !into {
+		return target + " = &" + value
+	}
+	return "if " + target + " == nil {\n" +
+		target + " = new(" + mapFieldTypeToGoType(field.Type) + ")\n" +
+		"}\n" +
+		"*" + target + " = " + value
+}
+
+// varIntReaders maps the varint schema types to their reader in the
+// protocol package.
+var varIntReaders = map[string]string{
+	"varint":  "ReadVarInt",
+	"varlong": "ReadVarLong",
+	"svarint": "ReadSVarInt",
+}
+
+type vectorType struct {
+	GoType string
+	Size   int
+}
+
+// vectorTypes are the built-in math types, backed by the Vec/Quat types in
+// the protocol package.
+var vectorTypes = map[string]vectorType{
+	"vec2f": {GoType: "Vec2f", Size: 8},
+	"vec3f": {GoType: "Vec3f", Size: 12},
+	"vec3d": {GoType: "Vec3d", Size: 24},
+	"vec3i": {GoType: "Vec3i", Size: 12},
+	"quatf": {GoType: "Quatf", Size: 16},
+}
+
+func generatePacketCode(file *FileNode, packet *PacketNode, options GenerateOptions) (string, error) {
+	code := ""
+	if comment := versionComment(packet.Versions); comment != "" {
+		code += "// " + comment + "\n"
+	}
+	if packet.Deprecated {
+		if code != "" {
+			code += "//\n"
+		}
+		code += "// Deprecated: kept for older clients.\n"
+	}
+	if packet.Unreliable {
+		if code != "" {
+			code += "//\n"
+		}
+		code += "// Sent as a QUIC datagram, it may be lost or arrive out of order.\n"
+	}
+	code += "type " + packet.Name + " struct {\n"
 	for _, field := range packet.Fields {
 		goType := mapFieldTypeToGoType(field.Type)
 
@@ -132,16 +292,112 @@ func generatePacketCode(file *FileNode, packet *PacketNode) (string, error) {
 			goType = "*" + goType
 		}
 
+		comment := versionComment(field.Versions)
+		if comment != "" {
+			code += "\t// " + comment + "\n"
+		}
+		if field.Deprecated {
+			if comment != "" {
+				code += "\t//\n"
+			}
+			code += "\t// Deprecated: kept for older clients.\n"
+		}
+
 		fieldName := capitalize(field.Name)
 		code += "\t" + fieldName + " " + goType + "\n"
 	}
 	code += "}\n\n"
 
-	//code += "func Decode" + packet.Name + "(payload []byte) (Packet, error) {\n"
-	//code += "\t// TODO: implement decoding logic\n"
-	//code += "\treturn &" + packet.Name + "{}, nil\n"
-	//code += "}\n\n"
+	getterCode, err := generateGetterCode(file, packet)
+	if err != nil {
+		return "", err
+	}
+	code += getterCode
+
+	// the unversioned functions use the newest layout
+	newest := packet.Newest()
+
+	parsingBody, byteSizeOfFixedFrame, err := writeDecodeBody(file, newest, false)
+	if err != nil {
+		return "", err
+	}
+
+	decodeBuf := bytes.NewBufferString("")
+
+	templateData := newDecodeData(newest, parsingBody, byteSizeOfFixedFrame)
+
+	err = decodeTemplate.Execute(decodeBuf, templateData)
+	if err != nil {
+		return "", err
+	}
+
+	code += decodeBuf.String() + "\n\n"
+
+	versionedCode, err := generateVersionedDecoders(file, packet)
+	if err != nil {
+		return "", err
+	}
+	code += versionedCode
+
+	if options.DecodeInto {
+		parsingBody, _, err = writeDecodeBody(file, newest, true)
+		if err != nil {
+			return "", err
+		}
+		templateData = newDecodeData(newest, parsingBody, byteSizeOfFixedFrame)
+
+		decodeIntoBuf := bytes.NewBufferString("")
+		err = decodeIntoTemplate.Execute(decodeIntoBuf, templateData)
+		if err != nil {
+			return "", err
+		}
+
+		code += decodeIntoBuf.String() + "\n\n"
+	}
+
+	encodeCode, err := generateEncoderCode(file, newest)
+	if err != nil {
+		return "", err
+	}
+	code += encodeCode + "\n"
+
+	code += "func (p *" + packet.Name + ") ID() uint32 {\n"
+	code += "\treturn " + fmt.Sprintf("%d", packet.ID) + "\n"
+	code += "}\n\n"
+
+	maxSize, err := maxVersionedPacketSize(file, packet)
+	if err != nil {
+		return "", err
+	}
+
+	code += "// " + packet.Name + "MaxSize is the largest payload a valid " + packet.Name + " can have.\n"
+	code += "const " + packet.Name + "MaxSize = " + strconv.Itoa(maxSize) + "\n\n"
+	code += "func (p *" + packet.Name + ") MaxSize() int {\n"
+	code += "\treturn " + packet.Name + "MaxSize\n"
+	code += "}\n"
+
+	return code, nil
+}
+
+func newDecodeData(packet *PacketNode, parsingBody string, sizeOfFixedFrame int) DecodeData {
+	data := DecodeData{
+		Packet:           packet,
+		ParsingBody:      parsingBody,
+		SizeOfFixedFrame: sizeOfFixedFrame,
+		// field templates declare err with := themselves, only plain
+		// assignments need it declared up front
+		NeedsErr: strings.Contains(parsingBody, "err = "),
+	}
+	for _, field := range packet.Fields {
+		data.NeedsNullBits = data.NeedsNullBits || field.Optional
+	}
+	return data
+}
 
+// writeDecodeBody returns the statements decoding every field of packet,
+// along with the size of the fixed frame (nullBits, fixed block and
+// offsets).
+func writeDecodeBody(file *FileNode, packet *PacketNode, into bool) (string, int, error) {
 	parsingBodyBuf := bytes.NewBufferString("")
 	currentOffset := 1
 
@@ -149,9 +405,9 @@ func generatePacketCode(file *FileNode, packet *PacketNode) (string, error) {
 
 	for _, field := range packet.Fields {
 		if field.Fixed {
-			fieldParserCode, newOffset, err := writeFieldParser(file, packet, &field, currentOffset)
+			fieldParserCode, newOffset, err := writeFieldParser(file, packet, &field, currentOffset, into)
 			if err != nil {
-				return "", err
+				return "", 0, err
 			}
 			parsingBodyBuf.WriteString(fieldParserCode)
 			currentOffset = newOffset
@@ -160,7 +416,7 @@ func generatePacketCode(file *FileNode, packet *PacketNode) (string, error) {
 
 	offsetCode, offset, err := writeFieldOffsets(packet, currentOffset)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	parsingBodyBuf.WriteString("\n// offsets\n")
 	parsingBodyBuf.WriteString(offsetCode)
@@ -176,14 +432,23 @@ func generatePacketCode(file *FileNode, packet *PacketNode) (string, error) {
 				parsingBodyBuf.WriteString("\tif (nullBits & 0x" + fmt.Sprintf("%02X", 1<<nonFixedFieldIndex) + ") != 0 {\n")
 			}
 
-			fieldParserCode, _, err := writeFieldParser(file, packet, &field, currentOffset)
+			// an offset must land inside the variable block
+			errReturn := newFieldData(&field, currentOffset, into).ErrReturn
+			parsingBodyBuf.WriteString("\tif " + field.Name + "Offset < 0 || " + field.Name + "Offset > len(payload)-" + strconv.Itoa(currentOffset) + " {\n")
+			parsingBodyBuf.WriteString("\t\treturn " + errReturn + "fmt.Errorf(\"invalid " + field.Name + " offset: %d\", " + field.Name + "Offset)\n")
+			parsingBodyBuf.WriteString("\t}\n")
+
+			fieldParserCode, _, err := writeFieldParser(file, packet, &field, currentOffset, into)
 			if err != nil {
-				return "", err
+				return "", 0, err
 			}
 			parsingBodyBuf.WriteString(fieldParserCode)
 
 			if field.Optional {
 				nonFixedFieldIndex++
+				if into {
+					parsingBodyBuf.WriteString("\t} else {\n\t\tpacket." + capitalize(field.Name) + " = nil\n")
+				}
 				parsingBodyBuf.WriteString("\t}\n")
 			}
 
@@ -191,29 +456,10 @@ func generatePacketCode(file *FileNode, packet *PacketNode) (string, error) {
 		}
 	}
 
-	decodeBuf := bytes.NewBufferString("")
-
-	templateData := DecodeData{
-		Packet:           packet,
-		ParsingBody:      parsingBodyBuf.String(),
-		SizeOfFixedFrame: byteSizeOfFixedFrame,
-	}
-
-	err = decodeTemplate.Execute(decodeBuf, templateData)
-	if err != nil {
-		return "", err
-	}
-
-	code += decodeBuf.String() + "\n"
-
-	code += "func (p *" + packet.Name + ") ID() uint32 {\n"
-	code += "\treturn " + fmt.Sprintf("%d", packet.ID) + "\n"
-	code += "}\n"
-
-	return code, nil
+	return parsingBodyBuf.String(), byteSizeOfFixedFrame, nil
 }
 
-func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset int) (string, int, error) {
+func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset int, into bool) (string, int, error) {
 	buf := bytes.NewBufferString("\n// Field " + field.Name + "\n")
 
 	if field.Type.Name == "ascii" || field.Type.Name == "utf8" || field.Type.Name == "string" {
@@ -221,7 +467,7 @@ func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset in
 			return "", 0, fmt.Errorf("string field %s must have a max size", field.Name)
 		}
 
-		fieldData := FieldData{Field: field, Offset: offset}
+		fieldData := newFieldData(field, offset, into)
 		err := stringsTemplate.Execute(buf, fieldData)
 		if err != nil {
 			return "", 0, err
@@ -229,7 +475,7 @@ func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset in
 
 		return buf.String(), offset + *field.Type.MaxSize, nil
 	} else if field.Type.Name == "uuid" {
-		fieldData := FieldData{Field: field, Offset: offset}
+		fieldData := newFieldData(field, offset, into)
 		err := uuidTemplate.Execute(buf, fieldData)
 		if err != nil {
 			return "", 0, err
@@ -237,7 +483,7 @@ func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset in
 
 		return buf.String(), offset + 16, nil
 	} else if strings.HasPrefix(field.Type.Name, "array") {
-		fieldData := FieldData{Field: field, Offset: offset}
+		fieldData := newFieldData(field, offset, into)
 		err := arrayTemplate.Execute(buf, fieldData)
 		if err != nil {
 			return "", 0, err
@@ -251,13 +497,37 @@ func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset in
 		}
 
 		return buf.String(), offset + *field.Type.MaxSize, nil
+	} else if reader, ok := varIntReaders[field.Type.Name]; ok {
+		if field.Fixed {
+			return "", 0, fmt.Errorf("%s field %s must be variable (prefix with @)", field.Type.Name, field.Name)
+		}
+
+		fieldData := newFieldData(field, offset, into)
+		fieldData.Reader = reader
+		fieldData.GoType = mapFieldTypeToGoType(field.Type)
+		err := varIntTemplate.Execute(buf, fieldData)
+		if err != nil {
+			return "", 0, err
+		}
+
+		return buf.String(), offset, nil
+	} else if vector, ok := vectorTypes[field.Type.Name]; ok {
+		fieldData := newFieldData(field, offset, into)
+		fieldData.Reader = "Read" + vector.GoType
+		fieldData.GoType = vector.GoType
+		err := vectorTemplate.Execute(buf, fieldData)
+		if err != nil {
+			return "", 0, err
+		}
+
+		return buf.String(), offset + vector.Size, nil
 	}
 
 	anyExpression := file.FindAny(field.Type.Name)
 
 	if anyExpression != nil {
 		if _, ok := anyExpression.(*EnumNode); ok {
-			fieldData := FieldData{Field: field, Offset: offset}
+			fieldData := newFieldData(field, offset, into)
 			err := enumTemplate.Execute(buf, fieldData)
 			if err != nil {
 				return "", 0, err
@@ -265,7 +535,7 @@ func writeFieldParser(file *FileNode, _ *PacketNode, field *FieldNode, offset in
 
 			return buf.String(), offset + 1, nil
 		} else if _, ok := anyExpression.(*TypeNode); ok {
-			fieldData := FieldData{Field: field, Offset: offset}
+			fieldData := newFieldData(field, offset, into)
 			err := callTypeTemplate.Execute(buf, fieldData)
 			if err != nil {
 				return "", 0, err
@@ -309,9 +579,16 @@ func mapFieldTypeToGoType(fieldType FieldTypeNode) string {
 		return "string"
 	case "uuid":
 		return "uuid.UUID"
+	case "varint", "svarint":
+		return "int32"
+	case "varlong":
+		return "int64"
 	case "array.byte":
 		return "[]byte"
 	default:
+		if vector, ok := vectorTypes[fieldType.Name]; ok {
+			return vector.GoType
+		}
 		return fieldType.Name
 	}
 }
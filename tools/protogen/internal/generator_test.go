@@ -0,0 +1,77 @@
+package protogen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDuplicatePacketID(t *testing.T) {
+	ast, err := NewParser(`
+	packet 3 First {
+		@name ascii[0:16]
+	}
+	packet 3 Second {
+		@name ascii[0:16]
+	}
+	`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+
+	_, err = GenerateGoCode(ast, GenerateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "duplicate packet id 3") {
+		t.Fatalf("expected duplicate id error, got %v", err)
+	}
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	ast, err := NewParser(`
+	type Address {
+		port uint16
+		host utf8[0:300]
+	}
+	packet 1 Hello {
+		@count varint
+		@name ascii[0:16]
+		@address? Address
+	}
+	packet 2 Unbounded {
+		@name string
+	}
+	`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+
+	// nullBits, three offsets, varint, 1+16 name, 2+(2+300) address
+	size, err := MaxPacketSize(ast, ast.FindPacket("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1 + 12 + 5 + 17 + 304; size != want {
+		t.Fatalf("MaxPacketSize(Hello) = %d, want %d", size, want)
+	}
+
+	if _, err := MaxPacketSize(ast, ast.FindPacket("Unbounded")); err == nil {
+		t.Fatal("expected an error for an unbounded field")
+	}
+}
+
+func TestUnreliableRegistry(t *testing.T) {
+	ast, err := NewParser(`
+	unreliable packet 7 Move {
+		position vec3d
+	}
+	`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+
+	code, err := GenerateGoCode(ast, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(code, "Unreliable: true") || !strings.Contains(code, "// Sent as a QUIC datagram") {
+		t.Fatalf("unreliable packet not marked:\n%s", code)
+	}
+}
@@ -0,0 +1,400 @@
+package protogen_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hygoal/tools/protogen/internal"
+	"hygoal/tools/protogen/internal/interp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/google/uuid"
+)
+
+// The golden harness generates code for the schemas in testdata/golden,
+// builds it next to the handwritten runtime of internal/protocol in a
+// throwaway module, and runs goldenDriver over the binary fixtures.
+// Fixtures are named <packet id>-<description>.bin, with .bad.bin for
+// payloads every decoder must reject. A .v<version> before the extension
+// decodes the fixture as sent by that protocol version instead. The report
+// notes the fixtures of packets the registry marks unreliable.
+//
+// The driver also writes every packet it decoded as JSON, which the test
+// checks field by field against the schema interpreter: both must accept
+// and reject the same fixtures and agree on every value.
+
+const goldenRuntime = "../../../internal/protocol"
+
+const goldenDriver = `package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golden/protocol"
+)
+
+func main() {
+	decoded := map[string]json.RawMessage{}
+	defer func() {
+		data, err := json.Marshal(decoded)
+		if err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(os.Args[2], data, 0644); err != nil {
+			panic(err)
+		}
+	}()
+
+	names, _ := filepath.Glob(filepath.Join(os.Args[1], "*.bin"))
+	for _, name := range names {
+		base := filepath.Base(name)
+		id, _ := strconv.Atoi(strings.SplitN(base, "-", 2)[0])
+		payload, err := os.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println("==", base)
+		if info, ok := protocol.LookupID(uint32(id)); ok && info.Unreliable {
+			fmt.Println("unreliable")
+		}
+		if version, ok := fixtureVersion(base); ok {
+			// only decoding follows older layouts
+			packet, err := decode(func() (protocol.Packet, error) { return protocol.DecodeByIDVersion(version, uint32(id), payload) })
+			report("DecodeVersion", packet, err)
+			if err == nil {
+				decoded[base] = json.RawMessage(show(packet))
+			}
+			continue
+		}
+
+		packet, err := decode(func() (protocol.Packet, error) { return protocol.DecodeByID(uint32(id), payload) })
+		report("Decode", packet, err)
+		pooled, err := decode(func() (protocol.Packet, error) { return protocol.DecodePooled(uint32(id), payload) })
+		report("DecodeInto", pooled, err)
+		if packet == nil || pooled == nil {
+			continue
+		}
+		decoded[base] = json.RawMessage(show(packet))
+
+		if show(packet) != show(pooled) {
+			fmt.Println("DecodeInto differs from Decode")
+		}
+		getters(packet)
+
+		encoded, err := protocol.Encode(nil, packet)
+		if err != nil {
+			fmt.Println("Encode error:", err)
+		} else if !bytes.Equal(encoded, payload) {
+			fmt.Printf("Encode differs: %x\n", encoded)
+		} else {
+			fmt.Println("Encode: round trip ok")
+		}
+	}
+}
+
+func fixtureVersion(name string) (int, bool) {
+	for _, part := range strings.Split(name, ".") {
+		if version, err := strconv.Atoi(strings.TrimPrefix(part, "v")); err == nil && strings.HasPrefix(part, "v") {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+// decode turns decoder panics into errors, so one bad path does not hide
+// the rest of the report.
+func decode(fn func() (protocol.Packet, error)) (packet protocol.Packet, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			packet, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+func report(path string, packet protocol.Packet, err error) {
+	if err != nil {
+		fmt.Printf("%s error: %v\n", path, err)
+		return
+	}
+	fmt.Printf("%s: %s\n", path, show(packet))
+}
+
+func show(packet protocol.Packet) string {
+	data, err := json.Marshal(packet)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func getters(packet protocol.Packet) {
+	value := reflect.ValueOf(packet)
+	for i := 0; i < value.NumMethod(); i++ {
+		method := value.Type().Method(i)
+		if strings.HasPrefix(method.Name, "Get") {
+			fmt.Printf("%s() = %v\n", method.Name, value.Method(i).Call(nil)[0])
+		}
+	}
+}
+`
+
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+
+	schemas, err := filepath.Glob("testdata/golden/*.schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &protogen.FileNode{}
+	for _, name := range schemas {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast, err := protogen.NewParser(string(data)).Parse()
+		if err != nil {
+			t.Fatal(protogen.FormatParseError(err, name))
+		}
+		file.Expressions = append(file.Expressions, ast.Expressions...)
+	}
+
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "protocol")
+	if err := os.Mkdir(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeGoldenModule(t, dir)
+	copyGoldenRuntime(t, pkg)
+
+	err = protogen.WriteGoFile(filepath.Join(pkg, "generated.go"), "protocol", file, protogen.GenerateOptions{DecodeInto: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated, err := os.ReadFile(filepath.Join(pkg, "generated.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps.MatchSnapshot(t, string(generated))
+
+	fixtures, err := filepath.Abs("testdata/golden/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vet := goldenCommand(dir, "vet", "./...")
+	if out, err := vet.CombinedOutput(); err != nil {
+		t.Fatalf("generated code does not vet: %v\n%s", err, out)
+	}
+
+	decodedFile := filepath.Join(dir, "decoded.json")
+	run := goldenCommand(dir, "run", ".", fixtures, decodedFile)
+	out, err := run.CombinedOutput()
+	if err != nil {
+		t.Fatalf("driver failed: %v\n%s", err, out)
+	}
+	snaps.MatchSnapshot(t, string(out))
+
+	in, err := interp.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareInterpreter(t, in, fixtures, decodedFile)
+}
+
+// compareInterpreter decodes every fixture with in and compares the result
+// with what the generated decoders made of it, as written by the driver.
+func compareInterpreter(t *testing.T, in *interp.Interpreter, fixtures, decodedFile string) {
+	t.Helper()
+
+	data, err := os.ReadFile(decodedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(fixtures, "*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		base := filepath.Base(name)
+		id, _ := strconv.Atoi(strings.SplitN(base, "-", 2)[0])
+		payload, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var obj *interp.Object
+		if version, ok := fixtureVersion(base); ok {
+			obj, err = in.DecodeVersion(version, uint32(id), payload)
+		} else {
+			obj, err = in.Decode(uint32(id), payload)
+		}
+		generated, accepted := decoded[base]
+		switch {
+		case err != nil && accepted:
+			t.Errorf("%s: interpreter rejected what the generated code decoded: %v", base, err)
+			continue
+		case err == nil && !accepted:
+			t.Errorf("%s: interpreter decoded what the generated code rejected: %s", base, obj)
+			continue
+		case err != nil:
+			continue
+		}
+
+		for _, field := range obj.Fields {
+			want := interpJSON(t, field.Value)
+			if got := generated[goFieldName(field.Name)]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: field %s is %v in the generated code, %v in the interpreter", base, field.Name, got, want)
+			}
+			delete(generated, goFieldName(field.Name))
+		}
+		// the struct holds the fields of every version, those missing
+		// from this layout stay zero
+		for name, value := range generated {
+			if value != nil && !reflect.ValueOf(value).IsZero() {
+				t.Errorf("%s: field %s is not in the layout but decoded to %v", base, name, value)
+			}
+		}
+	}
+}
+
+// interpJSON converts an interpreter value to what the generated struct
+// holding it marshals to, read back as plain JSON values. Numbers keep
+// their Go type until marshalled, so floats format the same on both sides.
+func interpJSON(t *testing.T, value any) any {
+	t.Helper()
+
+	data, err := json.Marshal(interpValue(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain any
+	if err := json.Unmarshal(data, &plain); err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func interpValue(value any) any {
+	switch value := value.(type) {
+	case *interp.Object:
+		fields := map[string]any{}
+		for _, field := range value.Fields {
+			fields[goFieldName(field.Name)] = interpValue(field.Value)
+		}
+		return fields
+	case interp.EnumValue:
+		return value.Ordinal
+	case uuid.UUID:
+		return value.String()
+	case []byte:
+		return base64.StdEncoding.EncodeToString(value)
+	case [2]float32:
+		return map[string]float32{"X": value[0], "Y": value[1]}
+	case [3]float32:
+		return map[string]float32{"X": value[0], "Y": value[1], "Z": value[2]}
+	case [3]float64:
+		return map[string]float64{"X": value[0], "Y": value[1], "Z": value[2]}
+	case [3]int32:
+		return map[string]int32{"X": value[0], "Y": value[1], "Z": value[2]}
+	case [4]float32:
+		return map[string]float32{"X": value[0], "Y": value[1], "Z": value[2], "W": value[3]}
+	}
+	return value
+}
+
+// goFieldName is the name the generator gives the Go field for a schema
+// field.
+func goFieldName(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func fixtureVersion(name string) (int, bool) {
+	for _, part := range strings.Split(name, ".") {
+		if version, err := strconv.Atoi(strings.TrimPrefix(part, "v")); err == nil && strings.HasPrefix(part, "v") {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+func writeGoldenModule(t *testing.T, dir string) {
+	t.Helper()
+
+	sum, err := os.ReadFile("../../../go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuidSum []string
+	for _, line := range strings.Split(string(sum), "\n") {
+		if strings.HasPrefix(line, "github.com/google/uuid ") {
+			uuidSum = append(uuidSum, line)
+		}
+	}
+
+	files := map[string]string{
+		"go.mod":  "module golden\n\ngo 1.25\n\nrequire github.com/google/uuid v1.6.0\n",
+		"go.sum":  strings.Join(uuidSum, "\n") + "\n",
+		"main.go": goldenDriver,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// copyGoldenRuntime copies the handwritten part of the protocol package,
+// which the generated code calls into.
+func copyGoldenRuntime(t *testing.T, pkg string) {
+	t.Helper()
+
+	names, err := filepath.Glob(filepath.Join(goldenRuntime, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		base := filepath.Base(name)
+		if base == "generated.go" || base == "protocol.go" || strings.HasSuffix(base, "_test.go") {
+			continue
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(pkg, base), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func goldenCommand(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	return cmd
+}
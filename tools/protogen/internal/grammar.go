@@ -2,28 +2,165 @@ package protogen
 
 import "fmt"
 
+// Parse parses the whole input. Errors do not stop parsing: the parser
+// skips ahead to the next declaration and carries on, and every error is
+// returned together as ParserErrors.
 func (p *Parser) Parse() (*FileNode, error) {
 	file := &FileNode{}
 
 	for !p.expect(TokenEOF) {
 		node, err := p.parseExpression()
 		if err != nil {
-			return nil, err
+			p.recordError(err)
+			p.synchronize()
+			continue
 		}
 		if node != nil {
 			file.Expressions = append(file.Expressions, node)
-		} else {
-			if p.expect(TokenEOF) {
-				break
-			}
-			return nil, p.getErrorf("unexpected token: %s", p.curTok.Value)
 		}
 	}
 
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+
 	return file, nil
 }
 
+// synchronize skips to the start of the next declaration.
+func (p *Parser) synchronize() {
+	for !p.expect(TokenEOF) && !p.atDeclaration() {
+		p.next()
+	}
+}
+
+// atDeclaration reports whether the current token starts a declaration.
+func (p *Parser) atDeclaration() bool {
+	if !p.expect(TokenKeyword) {
+		return false
+	}
+	return p.curTok.Value == "enum" || p.curTok.Value == "packet" || p.curTok.Value == "type"
+}
+
+// atAnnotation reports whether the current token starts an annotation
+// rather than a field: 'deprecated', or '@' followed by since( or until(.
+func (p *Parser) atAnnotation() bool {
+	if p.atDeprecated() {
+		return true
+	}
+	if !p.expect(TokenAt) {
+		return false
+	}
+	name, paren := p.peek(1), p.peek(2)
+	return name.Type == TokenIdent && (name.Value == "since" || name.Value == "until") && paren.Type == TokenLParen
+}
+
+// atDeprecated reports whether the current token is the 'deprecated'
+// modifier rather than a field named deprecated. The modifier comes before
+// '@', a declaration, 'unreliable' or a whole field, on its line or the
+// one before it, while a field name is followed by its type alone.
+func (p *Parser) atDeprecated() bool {
+	if !p.expect(TokenIdent) || p.curTok.Value != "deprecated" {
+		return false
+	}
+	next := p.peek(1)
+	switch {
+	case next.Type == TokenAt || next.Type == TokenKeyword || next.Line != p.curTok.Line:
+		return true
+	case next.Type == TokenIdent && next.Value == "unreliable":
+		return true
+	case next.Type == TokenIdent:
+		after := p.peek(2)
+		return after.Type == TokenIdent && after.Line == next.Line
+	}
+	return false
+}
+
+// atUnreliable reports whether the current token is the 'unreliable'
+// marker, which only packets take. It is only looked for between
+// declarations, inside them it is an ordinary identifier.
+func (p *Parser) atUnreliable() bool {
+	return p.expect(TokenIdent) && p.curTok.Value == "unreliable"
+}
+
+// parseAnnotations reads any annotations at the current position into
+// versions.
+func (p *Parser) parseAnnotations(versions *Versions) error {
+	for p.atAnnotation() {
+		if p.atDeprecated() {
+			versions.Deprecated = true
+			p.next() // advance after reading 'deprecated'
+			continue
+		}
+
+		p.next() // advance after reading '@'
+		name := p.curTok.Value
+		p.next() // advance after reading the annotation name
+		p.next() // advance after reading '('
+
+		if !p.expect(TokenNumber) {
+			return p.getErrorf("expected version but got %s", p.describeCurrent())
+		}
+		version, err := parseInt(p.curTok.Value)
+		if err != nil {
+			return p.getErrorf("invalid version: %s", p.curTok.Value)
+		}
+		p.next() // advance after reading the version
+
+		if !p.expect(TokenRParen) {
+			return p.getErrorf("expected ')' but got %s", p.describeCurrent())
+		}
+		p.next() // advance after reading ')'
+
+		if name == "since" {
+			versions.Since = &version
+		} else {
+			versions.Until = &version
+		}
+	}
+
+	if versions.Since != nil && versions.Until != nil && *versions.Until <= *versions.Since {
+		return p.getErrorf("@until(%d) must be after @since(%d)", *versions.Until, *versions.Since)
+	}
+
+	return nil
+}
+
+// synchronizeField skips the rest of a broken field, stopping at the end
+// of its line, the end of the block or the next declaration.
+func (p *Parser) synchronizeField(fieldLine int) {
+	for !p.expect(TokenEOF) && !p.expect(TokenRBrace) && !p.atDeclaration() && p.curTok.Line <= fieldLine {
+		p.next()
+	}
+}
+
 func (p *Parser) parseExpression() (Node, error) {
+	if p.atAnnotation() || p.atUnreliable() {
+		var versions Versions
+		unreliable := false
+		for p.atAnnotation() || p.atUnreliable() {
+			if p.atUnreliable() {
+				unreliable = true
+				p.next() // advance after reading 'unreliable'
+				continue
+			}
+			if err := p.parseAnnotations(&versions); err != nil {
+				return nil, err
+			}
+		}
+		if !p.expect(TokenKeyword) || p.curTok.Value != "packet" {
+			return nil, p.getErrorf("expected 'packet' after annotations but got %s", p.describeCurrent())
+		}
+
+		node, err := p.parsePacket()
+		if err != nil {
+			return nil, err
+		}
+		node.(*PacketNode).Versions = versions
+		node.(*PacketNode).Unreliable = unreliable
+		return node, nil
+	}
+
 	if p.expect(TokenKeyword) {
 		if p.curTok.Value == "enum" {
 			return p.parseEnum()
@@ -36,7 +173,9 @@ func (p *Parser) parseExpression() (Node, error) {
 		}
 	}
 
-	return nil, p.getErrorf("unexpected token: %s", p.curTok.Value)
+	err := p.getErrorf("unexpected token: %s", p.curTok.Value)
+	p.next()
+	return nil, err
 }
 
 func (p *Parser) parseEnum() (Node, error) {
@@ -116,12 +255,8 @@ func (p *Parser) parsePacket() (Node, error) {
 		Fields: []FieldNode{},
 	}
 
-	for !p.expect(TokenRBrace) {
-		fieldNode, err := p.parseField()
-		if err != nil {
-			return nil, err
-		}
-		packetNode.Fields = append(packetNode.Fields, *fieldNode)
+	if err := p.parseFields(&packetNode.Fields); err != nil {
+		return nil, err
 	}
 
 	if !p.expect(TokenRBrace) {
@@ -154,12 +289,8 @@ func (p *Parser) parseType() (Node, error) {
 		Fields: []FieldNode{},
 	}
 
-	for !p.expect(TokenRBrace) {
-		fieldNode, err := p.parseField()
-		if err != nil {
-			return nil, err
-		}
-		typeNode.Fields = append(typeNode.Fields, *fieldNode)
+	if err := p.parseFields(&typeNode.Fields); err != nil {
+		return nil, err
 	}
 
 	if !p.expect(TokenRBrace) {
@@ -170,7 +301,40 @@ func (p *Parser) parseType() (Node, error) {
 	return typeNode, nil
 }
 
+// parseFields parses fields up to the closing brace. A broken field is
+// recorded and skipped so the rest of the block is still checked.
+func (p *Parser) parseFields(fields *[]FieldNode) error {
+	for !p.expect(TokenRBrace) {
+		if p.expect(TokenEOF) || p.atDeclaration() {
+			return p.getErrorf("expected '}' but got %s", p.describeCurrent())
+		}
+
+		fieldLine := p.curTok.Line
+		fieldNode, err := p.parseField()
+		if err != nil {
+			p.recordError(err)
+			p.synchronizeField(fieldLine)
+			continue
+		}
+		*fields = append(*fields, *fieldNode)
+	}
+
+	return nil
+}
+
+func (p *Parser) describeCurrent() string {
+	if p.expect(TokenEOF) {
+		return "end of file"
+	}
+	return p.curTok.Value
+}
+
 func (p *Parser) parseField() (*FieldNode, error) {
+	var versions Versions
+	if err := p.parseAnnotations(&versions); err != nil {
+		return nil, err
+	}
+
 	isFixed := true
 	if p.expect(TokenAt) {
 		isFixed = false
@@ -194,11 +358,27 @@ func (p *Parser) parseField() (*FieldNode, error) {
 		return nil, err
 	}
 
+	var defaultValue *LiteralNode
+	if p.expect(TokenEqual) {
+		if !isOptional {
+			return nil, p.getErrorf("field %s has a default but is not optional", fieldName)
+		}
+		p.next() // advance after reading '='
+
+		if !p.expect(TokenString) && !p.expect(TokenNumber) && !p.expect(TokenIdent) {
+			return nil, p.getErrorf("expected default value but got %s", p.describeCurrent())
+		}
+		defaultValue = &LiteralNode{Type: p.curTok.Type, Value: p.curTok.Value}
+		p.next() // advance after reading default value
+	}
+
 	fieldNode := &FieldNode{
 		Name:     fieldName,
 		Type:     *fieldType,
 		Optional: isOptional,
 		Fixed:    isFixed,
+		Default:  defaultValue,
+		Versions: versions,
 	}
 
 	return fieldNode, nil
@@ -0,0 +1,299 @@
+// Package interp decodes packets by walking the schema AST at runtime
+// rather than through generated code.
+package interp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hygoal/tools/protogen/internal"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Interpreter struct {
+	file    *protogen.FileNode
+	packets map[uint32]*protogen.PacketNode
+}
+
+// Load parses every .schema file in dir.
+func Load(dir string) (*Interpreter, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &protogen.FileNode{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".schema") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		ast, err := protogen.NewParser(string(data)).Parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s", protogen.FormatParseError(err, entry.Name()))
+		}
+		file.Expressions = append(file.Expressions, ast.Expressions...)
+	}
+
+	return New(file)
+}
+
+func New(file *protogen.FileNode) (*Interpreter, error) {
+	in := &Interpreter{file: file, packets: map[uint32]*protogen.PacketNode{}}
+
+	for _, expr := range file.Expressions {
+		if packet, ok := expr.(*protogen.PacketNode); ok {
+			if existing, exists := in.packets[packet.ID]; exists {
+				return nil, fmt.Errorf("packets %s and %s share id %d", existing.Name, packet.Name, packet.ID)
+			}
+			in.packets[packet.ID] = packet
+		}
+	}
+
+	return in, nil
+}
+
+// Packet returns the schema declaration for a packet ID.
+func (in *Interpreter) Packet(id uint32) (*protogen.PacketNode, bool) {
+	packet, ok := in.packets[id]
+	return packet, ok
+}
+
+// Decode decodes the payload of a packet (everything after the length and
+// ID header) following the same layout rules as the generated decoders.
+// Versioned packets are read in their newest layout.
+func (in *Interpreter) Decode(id uint32, payload []byte) (*Object, error) {
+	packet, ok := in.packets[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet id %d", id)
+	}
+
+	return in.decodePacket(packet.Newest(), payload)
+}
+
+// DecodeVersion is Decode for a packet sent by a peer speaking version.
+func (in *Interpreter) DecodeVersion(version int, id uint32, payload []byte) (*Object, error) {
+	packet, ok := in.packets[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet id %d", id)
+	}
+	if !packet.Includes(version) {
+		return nil, fmt.Errorf("packet %s does not exist in version %d", packet.Name, version)
+	}
+
+	return in.decodePacket(packet.AtVersion(version), payload)
+}
+
+func (in *Interpreter) decodePacket(packet *protogen.PacketNode, payload []byte) (*Object, error) {
+	layout, err := protogen.ComputeLayout(in.file, packet)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) < layout.VariableBlockStart {
+		return nil, fmt.Errorf("%s payload too small: %d", packet.Name, len(payload))
+	}
+
+	obj := &Object{Name: packet.Name}
+	nullBits := payload[0]
+
+	for _, fl := range layout.Fixed {
+		value, _, err := in.decodeValue(fl.Field.Type, payload, fl.Offset, true)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", fl.Field.Name, err)
+		}
+		obj.Fields = append(obj.Fields, Field{Name: fl.Field.Name, Type: fl.Field.Type.Name, Value: value})
+	}
+
+	for _, fl := range layout.Variable {
+		field := Field{Name: fl.Field.Name, Type: fl.Field.Type.Name}
+
+		if fl.NullBit == 0 || nullBits&fl.NullBit != 0 {
+			offset := int(int32(binary.LittleEndian.Uint32(payload[fl.Offset : fl.Offset+4])))
+			if offset < 0 {
+				return nil, fmt.Errorf("%s has negative offset %d", fl.Field.Name, offset)
+			}
+
+			value, _, err := in.decodeValue(fl.Field.Type, payload, layout.VariableBlockStart+offset, false)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding %s: %w", fl.Field.Name, err)
+			}
+			field.Value = value
+		}
+
+		obj.Fields = append(obj.Fields, field)
+	}
+
+	return obj, nil
+}
+
+// DecodeType decodes a named type at pos. Types have no nullBits or offset
+// table; their fields are laid out back to back.
+func (in *Interpreter) DecodeType(name string, payload []byte, pos int) (*Object, int, error) {
+	typeN := in.file.FindType(name)
+	if typeN == nil {
+		return nil, 0, fmt.Errorf("unknown type %s", name)
+	}
+
+	obj := &Object{Name: typeN.Name}
+	start := pos
+	for _, f := range typeN.Fields {
+		value, size, err := in.decodeValue(f.Type, payload, pos, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error decoding %s.%s: %w", typeN.Name, f.Name, err)
+		}
+		obj.Fields = append(obj.Fields, Field{Name: f.Name, Type: f.Type.Name, Value: value})
+		pos += size
+	}
+
+	return obj, pos - start, nil
+}
+
+func (in *Interpreter) decodeValue(fieldType protogen.FieldTypeNode, payload []byte, pos int, fixed bool) (any, int, error) {
+	if pos < 0 || pos > len(payload) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	if size, ok := primitiveSizes[fieldType.Name]; ok {
+		if pos+size > len(payload) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return decodePrimitive(fieldType.Name, payload[pos:pos+size]), size, nil
+	}
+
+	switch fieldType.Name {
+	case "uuid":
+		if pos+16 > len(payload) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		value, err := uuid.FromBytes(payload[pos : pos+16])
+		return value, 16, err
+	case "ascii", "utf8", "string":
+		if fieldType.MinSize == nil && fieldType.MaxSize != nil {
+			end := pos + *fieldType.MaxSize
+			if end > len(payload) {
+				return nil, 0, io.ErrUnexpectedEOF
+			}
+			// zero padding is not part of the value
+			return strings.TrimRight(string(payload[pos:end]), "\x00"), *fieldType.MaxSize, nil
+		}
+		if fixed {
+			return nil, 0, fmt.Errorf("variable length %s in fixed block", fieldType.Name)
+		}
+
+		n, nLen, err := readVarUint(payload, pos, 5, 32)
+		if err != nil {
+			return nil, 0, err
+		}
+		if fieldType.MaxSize != nil && int64(n) > int64(*fieldType.MaxSize) {
+			return nil, 0, fmt.Errorf("string length %d > max %d", n, *fieldType.MaxSize)
+		}
+		if fieldType.MinSize != nil && int64(n) < int64(*fieldType.MinSize) {
+			return nil, 0, fmt.Errorf("string length %d < min %d", n, *fieldType.MinSize)
+		}
+		start := pos + nLen
+		if uint64(start)+n > uint64(len(payload)) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return string(payload[start : start+int(n)]), nLen + int(n), nil
+	case "varint":
+		v, size, err := readVarUint(payload, pos, 5, 32)
+		return int32(uint32(v)), size, err
+	case "varlong":
+		v, size, err := readVarUint(payload, pos, 10, 64)
+		return int64(v), size, err
+	case "svarint":
+		v, size, err := readVarUint(payload, pos, 5, 32)
+		u := uint32(v)
+		return int32(u>>1) ^ -int32(u&1), size, err
+	case "vec2f", "vec3f", "vec3d", "vec3i", "quatf":
+		return decodeVector(fieldType.Name, payload, pos)
+	case "array.byte":
+		v, nLen, err := readVarUint(payload, pos, 5, 32)
+		if err != nil {
+			return nil, 0, err
+		}
+		n := int(int32(uint32(v)))
+		if n < 0 || (fieldType.MinSize != nil && n < *fieldType.MinSize) {
+			return nil, 0, fmt.Errorf("invalid length: %d", n)
+		}
+		if fieldType.MaxSize != nil && n > *fieldType.MaxSize {
+			return nil, 0, fmt.Errorf("length too large: %d", n)
+		}
+		start := pos + nLen
+		if start+n > len(payload) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return append([]byte(nil), payload[start:start+n]...), nLen + n, nil
+	}
+
+	switch node := in.file.FindAny(fieldType.Name).(type) {
+	case *protogen.EnumNode:
+		if pos >= len(payload) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		ordinal := int(payload[pos])
+		value := EnumValue{Enum: node.Name, Ordinal: ordinal}
+		if ordinal < len(node.Values) {
+			value.Name = node.Values[ordinal].Name
+		}
+		return value, 1, nil
+	case *protogen.TypeNode:
+		return in.DecodeType(node.Name, payload, pos)
+	}
+
+	return nil, 0, fmt.Errorf("unsupported type %s", fieldType.Name)
+}
+
+var primitiveSizes = map[string]int{
+	"bool":    1,
+	"int8":    1,
+	"uint8":   1,
+	"byte":    1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"float32": 4,
+	"int64":   8,
+	"uint64":  8,
+	"float64": 8,
+}
+
+func decodePrimitive(name string, b []byte) any {
+	switch name {
+	case "bool":
+		return b[0] != 0
+	case "int8":
+		return int8(b[0])
+	case "uint8", "byte":
+		return b[0]
+	case "int16":
+		return int16(binary.LittleEndian.Uint16(b))
+	case "uint16":
+		return binary.LittleEndian.Uint16(b)
+	case "int32":
+		return int32(binary.LittleEndian.Uint32(b))
+	case "uint32":
+		return binary.LittleEndian.Uint32(b)
+	case "float32":
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case "int64":
+		return int64(binary.LittleEndian.Uint64(b))
+	case "uint64":
+		return binary.LittleEndian.Uint64(b)
+	case "float64":
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return nil
+}
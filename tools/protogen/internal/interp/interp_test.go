@@ -0,0 +1,93 @@
+package interp
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDecodeConnect(t *testing.T) {
+	in, err := Load("../../../../api/protocol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := uuid.MustParse("0b8e8a4b-6f1e-4c2a-9d53-5d7ae1d6c3f0")
+	hash := strings.Repeat("ab", 32)
+
+	payload := make([]byte, 102)
+	payload[0] = 0x01 | 0x08 // language, referralSource
+	copy(payload[1:65], hash)
+	payload[65] = 1 // EDITOR
+	copy(payload[66:82], id[:])
+
+	var variable []byte
+	putOffset := func(slot int, value int) {
+		binary.LittleEndian.PutUint32(payload[slot:slot+4], uint32(int32(value)))
+	}
+
+	putOffset(82, len(variable))
+	variable = append(variable, 5)
+	variable = append(variable, "en-GB"...)
+	putOffset(86, -1)
+	putOffset(90, len(variable))
+	variable = append(variable, 6)
+	variable = append(variable, "Steve1"...)
+	putOffset(94, -1)
+	putOffset(98, len(variable))
+	variable = binary.LittleEndian.AppendUint16(variable, 5520)
+	variable = append(variable, 9)
+	variable = append(variable, "localhost"...)
+
+	obj, err := in.Decode(0, append(payload, variable...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]any{
+		"protocolHash":  hash,
+		"clientType":    EnumValue{Enum: "ClientType", Name: "EDITOR", Ordinal: 1},
+		"UUID":          id,
+		"language":      "en-GB",
+		"identityToken": nil,
+		"username":      "Steve1",
+		"referralData":  nil,
+	}
+	for name, want := range expect {
+		got, ok := obj.Get(name)
+		if !ok {
+			t.Fatalf("missing field %s", name)
+		}
+		if got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+
+	source, _ := obj.Get("referralSource")
+	host, ok := source.(*Object)
+	if !ok {
+		t.Fatalf("referralSource = %v, want *Object", source)
+	}
+	if port, _ := host.Get("port"); port != uint16(5520) {
+		t.Errorf("port = %v, want 5520", port)
+	}
+	if hostname, _ := host.Get("hostname"); hostname != "localhost" {
+		t.Errorf("hostname = %v, want localhost", hostname)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	in, err := Load("../../../../api/protocol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := in.Decode(0, make([]byte, 50)); err == nil {
+		t.Fatal("expected error for truncated payload")
+	}
+	if _, err := in.Decode(999, nil); err == nil {
+		t.Fatal("expected error for unknown packet")
+	}
+}
@@ -0,0 +1,73 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Object is a decoded packet or type. Fields keep their schema order.
+type Object struct {
+	Name   string
+	Fields []Field
+}
+
+// Field is a single decoded value. Value is nil when an optional field is
+// absent, otherwise one of the Go primitives, string, []byte, uuid.UUID,
+// EnumValue or *Object.
+type Field struct {
+	Name  string
+	Type  string
+	Value any
+}
+
+type EnumValue struct {
+	Enum    string
+	Name    string
+	Ordinal int
+}
+
+func (e EnumValue) String() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s(%d)", e.Enum, e.Ordinal)
+	}
+	return e.Name
+}
+
+func (o *Object) Get(name string) (any, bool) {
+	for _, field := range o.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (o *Object) String() string {
+	buf := &strings.Builder{}
+	o.write(buf, 0)
+	return buf.String()
+}
+
+func (o *Object) write(buf *strings.Builder, depth int) {
+	buf.WriteString(o.Name + " {\n")
+	indent := strings.Repeat("  ", depth+1)
+
+	for _, field := range o.Fields {
+		buf.WriteString(indent + field.Name + " " + field.Type + " = ")
+		switch value := field.Value.(type) {
+		case nil:
+			buf.WriteString("<absent>")
+		case *Object:
+			value.write(buf, depth+1)
+		case string:
+			buf.WriteString(fmt.Sprintf("%q", value))
+		case []byte:
+			buf.WriteString(fmt.Sprintf("[% x]", value))
+		default:
+			buf.WriteString(fmt.Sprintf("%v", value))
+		}
+		buf.WriteString("\n")
+	}
+
+	buf.WriteString(strings.Repeat("  ", depth) + "}")
+}
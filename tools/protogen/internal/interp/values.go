@@ -0,0 +1,78 @@
+package interp
+
+import (
+	"errors"
+	"io"
+)
+
+// The interpreter deliberately has its own readers rather than using the
+// protocol package, so it stays an independent check of the generated
+// code (and protogen does not depend on the package it generates).
+
+var (
+	errVarIntTooLong      = errors.New("varint longer than maximum length")
+	errVarIntOverflow     = errors.New("varint overflows its type")
+	errVarIntNonCanonical = errors.New("varint is not minimally encoded")
+)
+
+func readVarUint(payload []byte, pos int, maxLen int, bits uint) (uint64, int, error) {
+	var value uint64
+	for i := 0; i < maxLen; i++ {
+		if pos+i >= len(payload) {
+			return 0, i, io.ErrUnexpectedEOF
+		}
+
+		b := payload[pos+i]
+		value |= uint64(b&0x7F) << (7 * uint(i))
+
+		if b&0x80 == 0 {
+			if i > 0 && b == 0 {
+				return 0, i + 1, errVarIntNonCanonical
+			}
+			if i == maxLen-1 && b>>(bits-7*uint(maxLen-1)) != 0 {
+				return 0, i + 1, errVarIntOverflow
+			}
+			return value, i + 1, nil
+		}
+	}
+
+	return 0, maxLen, errVarIntTooLong
+}
+
+// decodeVector returns the components of a built-in math type as an array,
+// e.g. [3]float32 for vec3f or [4]float32 (x, y, z, w) for quatf.
+func decodeVector(name string, payload []byte, pos int) (any, int, error) {
+	component, count := "float32", 3
+	switch name {
+	case "vec2f":
+		count = 2
+	case "vec3d":
+		component = "float64"
+	case "vec3i":
+		component = "int32"
+	case "quatf":
+		count = 4
+	}
+
+	size := primitiveSizes[component]
+	if pos+size*count > len(payload) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	read := func(i int) any {
+		return decodePrimitive(component, payload[pos+i*size:pos+(i+1)*size])
+	}
+
+	switch name {
+	case "vec2f":
+		return [2]float32{read(0).(float32), read(1).(float32)}, 8, nil
+	case "vec3f":
+		return [3]float32{read(0).(float32), read(1).(float32), read(2).(float32)}, 12, nil
+	case "vec3d":
+		return [3]float64{read(0).(float64), read(1).(float64), read(2).(float64)}, 24, nil
+	case "vec3i":
+		return [3]int32{read(0).(int32), read(1).(int32), read(2).(int32)}, 12, nil
+	default:
+		return [4]float32{read(0).(float32), read(1).(float32), read(2).(float32), read(3).(float32)}, 16, nil
+	}
+}
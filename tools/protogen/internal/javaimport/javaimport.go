@@ -0,0 +1,459 @@
+// Package javaimport drafts .schema declarations from decompiled Java
+// packet classes, by reading the calls their serialize and deserialize
+// methods make.
+package javaimport
+
+import (
+	"fmt"
+	"hygoal/tools/protogen/internal"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is one Java file to import.
+type Source struct {
+	Name string
+	Text string
+}
+
+// LoadSources reads the given .java files, and every .java file below the
+// given directories.
+func LoadSources(paths []string) ([]Source, error) {
+	var sources []Source
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(name string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !strings.HasSuffix(name, ".java") {
+				return nil
+			}
+
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, Source{Name: name, Text: string(data)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sources, nil
+}
+
+// Import drafts a schema from sources. Anything it cannot map is left out
+// of the schema and explained in the returned warnings, which name the
+// source file and class.
+func Import(sources []Source) (*protogen.FileNode, []string) {
+	im := &importer{}
+
+	for _, source := range sources {
+		for _, c := range parseSource(source.Text) {
+			im.source = source.Name
+			im.class = c.Name
+			im.addClass(c)
+		}
+	}
+
+	return im.finish()
+}
+
+type importer struct {
+	source, class string
+
+	enums   []*protogen.EnumNode
+	types   []*protogen.TypeNode
+	packets []*protogen.PacketNode
+
+	// constants of each packet, to check the drafted layout against
+	constants map[string]map[string]int
+	// nullBits holds the bit each optional field sets in Java
+	nullBits map[string]map[string]int
+	origin   map[string]string
+
+	warnings []string
+}
+
+func (im *importer) warnf(format string, args ...any) {
+	im.warnings = append(im.warnings, fmt.Sprintf("%s: %s: ", im.source, im.class)+fmt.Sprintf(format, args...))
+}
+
+func (im *importer) addClass(c class) {
+	if c.Enum {
+		im.addEnum(c)
+		return
+	}
+
+	if c.Serialize == "" {
+		im.warnf("skipped, no serialize method")
+		return
+	}
+
+	a := analyze(c)
+	for _, name := range a.unmapped {
+		im.warnf("field %s: could not map its serialization, left out", name)
+	}
+
+	id, isPacket := c.Constants["PACKET_ID"]
+
+	fields := make([]protogen.FieldNode, 0, len(a.fields))
+	for _, f := range a.fields {
+		field := protogen.FieldNode{
+			Name:     f.name,
+			Type:     f.fieldType,
+			Optional: f.nullable,
+			Fixed:    !isPacket || !f.variable,
+		}
+
+		if f.missingBound {
+			im.warnf("field %s: no size bound found", f.name)
+		}
+		if f.nullable && !isPacket {
+			im.warnf("field %s: nullable fields are not supported in types, drafted as optional", f.name)
+		}
+		if isPacket && f.nullable && field.Fixed {
+			im.warnf("field %s: nullable fixed-block field drafted as variable, the layout will differ", f.name)
+			field.Fixed = false
+		}
+
+		fields = append(fields, field)
+	}
+
+	if !isPacket {
+		im.types = append(im.types, &protogen.TypeNode{Name: c.Name, Fields: fields})
+		return
+	}
+
+	if id < 0 {
+		im.warnf("negative PACKET_ID %d", id)
+		return
+	}
+
+	im.packets = append(im.packets, &protogen.PacketNode{Name: c.Name, ID: uint32(id), Fields: fields})
+	if im.constants == nil {
+		im.constants = map[string]map[string]int{}
+		im.nullBits = map[string]map[string]int{}
+		im.origin = map[string]string{}
+	}
+	im.constants[c.Name] = c.Constants
+	im.nullBits[c.Name] = a.nullBits
+	im.origin[c.Name] = im.source
+}
+
+func (im *importer) addEnum(c class) {
+	enum := &protogen.EnumNode{Name: c.Name}
+
+	for i, value := range c.EnumValues {
+		if value.Value != nil && *value.Value != i {
+			im.warnf("value %s is %d on the wire but %d in the schema", value.Name, *value.Value, i)
+		}
+		enum.Values = append(enum.Values, protogen.EnumValueNode{Name: upperSnake(value.Name)})
+	}
+
+	im.enums = append(im.enums, enum)
+}
+
+// finish assembles the schema and checks every packet's layout against the
+// sizes the Java class declares.
+func (im *importer) finish() (*protogen.FileNode, []string) {
+	file := &protogen.FileNode{}
+	for _, enum := range im.enums {
+		file.Expressions = append(file.Expressions, enum)
+	}
+	for _, typeNode := range im.types {
+		file.Expressions = append(file.Expressions, typeNode)
+	}
+
+	sort.SliceStable(im.packets, func(i, j int) bool {
+		return im.packets[i].ID < im.packets[j].ID
+	})
+	for _, packet := range im.packets {
+		file.Expressions = append(file.Expressions, packet)
+	}
+
+	for _, packet := range im.packets {
+		im.source, im.class = im.origin[packet.Name], packet.Name
+
+		layout, err := protogen.ComputeLayout(file, packet)
+		if err != nil {
+			im.warnf("cannot check layout: %v", err)
+			continue
+		}
+
+		constants := im.constants[packet.Name]
+		if start, ok := constants["VARIABLE_BLOCK_START"]; ok && start != layout.VariableBlockStart {
+			im.warnf("VARIABLE_BLOCK_START is %d but the draft's is %d", start, layout.VariableBlockStart)
+		}
+		if size, ok := constants["FIXED_BLOCK_SIZE"]; ok && size != layout.VariableBlockStart-4*len(layout.Variable) {
+			im.warnf("FIXED_BLOCK_SIZE is %d but the draft's is %d", size, layout.VariableBlockStart-4*len(layout.Variable))
+		}
+		if count, ok := constants["VARIABLE_FIELD_COUNT"]; ok && count != len(layout.Variable) {
+			im.warnf("VARIABLE_FIELD_COUNT is %d but the draft has %d", count, len(layout.Variable))
+		}
+
+		for _, fl := range layout.Variable {
+			bit, ok := im.nullBits[packet.Name][fl.Field.Name]
+			if ok && bit != int(fl.NullBit) {
+				im.warnf("field %s: null bit is 0x%02X but the draft's is 0x%02X", fl.Field.Name, bit, fl.NullBit)
+			}
+		}
+	}
+
+	return file, im.warnings
+}
+
+// analysis is the schema view of one class' serialize method.
+type analysis struct {
+	fields   []analyzedField
+	nullBits map[string]int
+	unmapped []string
+}
+
+type analyzedField struct {
+	name         string
+	fieldType    protogen.FieldTypeNode
+	nullable     bool
+	variable     bool
+	missingBound bool
+}
+
+// writePatterns recognise how a field is written. The first group is the
+// field, the optional second one a size argument.
+var writePatterns = []struct {
+	re   *regexp.Regexp
+	kind string
+}{
+	{regexp.MustCompile(`PacketIO\.writeFixedAsciiString\(\s*\w+\s*,\s*this\.(\w+)\s*,\s*(\w+)\s*\)`), "ascii-fixed"},
+	{regexp.MustCompile(`PacketIO\.writeFixedString\(\s*\w+\s*,\s*this\.(\w+)\s*,\s*(\w+)\s*\)`), "utf8-fixed"},
+	{regexp.MustCompile(`PacketIO\.writeVarAsciiString\(\s*\w+\s*,\s*this\.(\w+)\s*(?:,\s*(\w+)\s*)?\)`), "ascii"},
+	{regexp.MustCompile(`PacketIO\.writeVarString\(\s*\w+\s*,\s*this\.(\w+)\s*(?:,\s*(\w+)\s*)?\)`), "string"},
+	{regexp.MustCompile(`PacketIO\.writeUUID\(\s*\w+\s*,\s*this\.(\w+)\s*\)`), "uuid"},
+	{regexp.MustCompile(`VarInt\.write\(\s*\w+\s*,\s*this\.(\w+)\.length\s*\)`), "length"},
+	{regexp.MustCompile(`VarInt\.write\(\s*\w+\s*,\s*this\.(\w+)\s*\)`), "varint"},
+	{regexp.MustCompile(`\.writeBytes\(\s*this\.(\w+)\s*\)`), "array.byte"},
+	{regexp.MustCompile(`\.writeByte\(\s*this\.(\w+)\.getValue\(\)\s*\)`), "enum"},
+	{regexp.MustCompile(`\.writeByte\(\s*this\.(\w+)\s*\?\s*1\s*:\s*0\s*\)`), "bool"},
+	{regexp.MustCompile(`\.writeByte\(\s*this\.(\w+)\s*\)`), "int8"},
+	{regexp.MustCompile(`\.writeShortLE\(\s*this\.(\w+)\s*\)`), "int16"},
+	{regexp.MustCompile(`\.writeIntLE\(\s*this\.(\w+)\s*\)`), "int32"},
+	{regexp.MustCompile(`\.writeLongLE\(\s*this\.(\w+)\s*\)`), "int64"},
+	{regexp.MustCompile(`\.writeFloatLE\(\s*this\.(\w+)\s*\)`), "float32"},
+	{regexp.MustCompile(`\.writeDoubleLE\(\s*this\.(\w+)\s*\)`), "float64"},
+	{regexp.MustCompile(`this\.(\w+)\.serialize\(`), "type"},
+}
+
+var (
+	offsetSlotRe = regexp.MustCompile(`\bint\s+(\w+)OffsetSlot\s*=`)
+	nullCheckRe  = regexp.MustCompile(`this\.(\w+)\s*!=\s*null`)
+	nullBitRe    = regexp.MustCompile(`nullBits\s*\|\s*(\d+)`)
+	lengthCheck  = regexp.MustCompile(`\b(\w+?)(?:Len|Length|Count)\s*>\s*(\w+)\s*\)`)
+	exceptionRe  = regexp.MustCompile(`ProtocolException\.\w+\(\s*"(\w+)"\s*,\s*\w+\s*,\s*(\w+)\s*\)`)
+)
+
+// javaVectors maps the math classes to the built-in vector types.
+var javaVectors = map[string]string{
+	"Vector2f":    "vec2f",
+	"Vector3f":    "vec3f",
+	"Vector3d":    "vec3d",
+	"Vector3i":    "vec3i",
+	"Quaternionf": "quatf",
+}
+
+func analyze(c class) analysis {
+	a := analysis{nullBits: map[string]int{}}
+
+	declared := map[string]javaField{}
+	for _, f := range c.Fields {
+		declared[f.Name] = f
+	}
+
+	resolve := func(s string) (int, bool) {
+		if n, err := strconv.Atoi(s); err == nil {
+			return n, true
+		}
+		n, ok := c.Constants[s]
+		return n, ok
+	}
+
+	// size bounds are checked while deserializing, keyed by lowercase name
+	bounds := map[string]int{}
+	for _, re := range []*regexp.Regexp{lengthCheck, exceptionRe} {
+		for _, match := range re.FindAllStringSubmatch(c.Deserialize, -1) {
+			if n, ok := resolve(match[2]); ok {
+				bounds[strings.ToLower(match[1])] = n
+			}
+		}
+	}
+
+	type write struct {
+		kind string
+		size string
+	}
+	writes := map[string]write{}
+	var order, slots []string
+	nullable := map[string]bool{}
+
+	for _, statement := range splitStatements(c.Serialize) {
+		if match := offsetSlotRe.FindStringSubmatch(statement); match != nil {
+			slots = append(slots, match[1])
+			continue
+		}
+
+		if check := nullCheckRe.FindStringSubmatch(statement); check != nil {
+			nullable[check[1]] = true
+			if bit := nullBitRe.FindStringSubmatch(statement); bit != nil {
+				n, _ := strconv.Atoi(bit[1])
+				a.nullBits[check[1]] = n
+			}
+		}
+
+		for _, pattern := range writePatterns {
+			match := pattern.re.FindStringSubmatch(statement)
+			if match == nil {
+				continue
+			}
+			name := match[1]
+			if _, seen := writes[name]; !seen {
+				order = append(order, name)
+			}
+			// a length prefix is followed by the bytes it counts
+			if prev, seen := writes[name]; !seen || prev.kind == "length" {
+				w := write{kind: pattern.kind}
+				if len(match) > 2 {
+					w.size = match[2]
+				}
+				writes[name] = w
+			}
+			break
+		}
+	}
+
+	variable := map[string]bool{}
+	for _, slot := range slots {
+		variable[slot] = true
+	}
+
+	build := func(name string) (analyzedField, bool) {
+		w := writes[name]
+		javaType := declared[name].Type
+		f := analyzedField{
+			name:     name,
+			nullable: nullable[name] || declared[name].Nullable,
+			variable: variable[name],
+		}
+
+		bound := func(explicit string) *int {
+			if n, ok := resolve(explicit); ok {
+				return &n
+			}
+			if n, ok := bounds[strings.ToLower(name)]; ok {
+				return &n
+			}
+			return nil
+		}
+
+		switch w.kind {
+		case "ascii-fixed", "utf8-fixed":
+			f.fieldType.Name = strings.TrimSuffix(w.kind, "-fixed")
+			f.fieldType.MaxSize = bound(w.size)
+			f.missingBound = f.fieldType.MaxSize == nil
+		case "ascii", "string", "array.byte":
+			f.fieldType.Name = w.kind
+			if w.kind == "string" {
+				f.fieldType.Name = stringCharset(c.Deserialize, name)
+			}
+			if maxSize := bound(w.size); maxSize != nil {
+				minSize := 0
+				f.fieldType.MinSize = &minSize
+				f.fieldType.MaxSize = maxSize
+			} else {
+				f.fieldType.Name = strings.Replace(f.fieldType.Name, "utf8", "string", 1)
+				f.missingBound = f.variable
+			}
+		case "enum", "type":
+			f.fieldType.Name = javaType
+			if vector, ok := javaVectors[javaType]; ok {
+				f.fieldType.Name = vector
+			}
+		case "int8", "int16":
+			f.fieldType.Name = w.kind
+			if regexp.MustCompile(`obj\.` + name + `\s*=\s*[^;]*getUnsigned`).MatchString(c.Deserialize) {
+				f.fieldType.Name = "u" + w.kind
+			}
+		case "length", "":
+			return f, false
+		default:
+			f.fieldType.Name = w.kind
+		}
+
+		return f, true
+	}
+
+	mapped := map[string]bool{}
+	var fixed, variableFields []analyzedField
+	for _, name := range order {
+		f, ok := build(name)
+		if !ok {
+			continue
+		}
+		mapped[name] = true
+		if !f.variable {
+			fixed = append(fixed, f)
+		}
+	}
+	// variable data is laid out in offset table order
+	for _, name := range slots {
+		if f, ok := build(name); ok {
+			mapped[name] = true
+			variableFields = append(variableFields, f)
+		}
+	}
+	a.fields = append(fixed, variableFields...)
+
+	for _, f := range c.Fields {
+		if !mapped[f.Name] {
+			a.unmapped = append(a.unmapped, f.Name)
+		}
+	}
+
+	return a
+}
+
+// stringCharset tells from the deserializer which charset a var string is
+// read with.
+func stringCharset(deserialize, name string) string {
+	match := regexp.MustCompile(`obj\.` + name + `\s*=\s*PacketIO\.read(\w*)String\(([^;]*)\)`).FindStringSubmatch(deserialize)
+	if match != nil && (strings.Contains(match[1], "Ascii") || strings.Contains(match[2], "ASCII")) {
+		return "ascii"
+	}
+	return "utf8"
+}
+
+// splitStatements breaks a method body on statement and block boundaries,
+// which keeps an if condition apart from the writes it guards unless they
+// share a single unbraced statement.
+func splitStatements(body string) []string {
+	return strings.FieldsFunc(body, func(r rune) bool {
+		return r == ';' || r == '{' || r == '}'
+	})
+}
+
+// upperSnake turns Java enum names like SomeValue into SOME_VALUE.
+func upperSnake(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' && name[i-1] >= 'a' && name[i-1] <= 'z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
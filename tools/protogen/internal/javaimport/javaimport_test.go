@@ -0,0 +1,53 @@
+package javaimport
+
+import (
+	"hygoal/tools/protogen/internal"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+)
+
+func TestImportConnect(t *testing.T) {
+	sources, err := LoadSources([]string{"testdata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, warnings := Import(sources)
+	if len(warnings) > 0 {
+		t.Fatalf("unexpected warnings: %q", warnings)
+	}
+
+	schema := protogen.FormatSchema(file)
+	snaps.MatchSnapshot(t, schema)
+
+	// the draft must be valid schema
+	if _, err := protogen.NewParser(schema).Parse(); err != nil {
+		t.Fatal(protogen.FormatParseError(err, "draft"))
+	}
+}
+
+func TestImportWarnings(t *testing.T) {
+	_, warnings := Import([]Source{{Name: "Odd.java", Text: `
+		public enum Sparse { First(0), Second(5); }
+
+		public class Odd implements Packet {
+			public static final int PACKET_ID = 7;
+			public static final int VARIABLE_BLOCK_START = 99;
+			public Item[] items;
+			public int count;
+
+			public void serialize(ByteBuf buf) {
+				buf.writeIntLE(this.count);
+				for (Item item : this.items) {
+					item.serialize(buf);
+				}
+			}
+		}
+
+		class Helper {
+		}
+	`}})
+
+	snaps.MatchSnapshot(t, warnings)
+}
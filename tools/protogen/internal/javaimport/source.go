@@ -0,0 +1,250 @@
+package javaimport
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// class is what the importer needs from one decompiled Java class or enum.
+type class struct {
+	Name        string
+	Enum        bool
+	EnumValues  []enumValue
+	Constants   map[string]int
+	Fields      []javaField
+	Serialize   string
+	Deserialize string
+}
+
+type enumValue struct {
+	Name  string
+	Value *int
+}
+
+type javaField struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+var (
+	declRe     = regexp.MustCompile(`\b(class|enum)\s+(\w+)[^{;]*$`)
+	constantRe = regexp.MustCompile(`\bstatic\s+final\s+(?:int|long|short|byte)\s+(\w+)\s*=\s*(-?\d+)`)
+	fieldRe    = regexp.MustCompile(`^((?:@[\w.]+\s+)*)(?:(?:public|protected|private|final|transient|volatile)\s+)*([\w.]+(?:<[^=]*>)?(?:\[\])*)\s+(\w+)\s*(?:=.*)?$`)
+	methodRe   = regexp.MustCompile(`\b(serialize|deserialize)\s*\([^)]*\)\s*(?:throws\s+[\w.,\s]+)?$`)
+	enumItemRe = regexp.MustCompile(`^(\w+)\s*(?:\(\s*(-?\d+)\s*\))?`)
+)
+
+// parseSource returns the top-level classes and enums declared in src.
+// Nested declarations are left to their own files, as decompilers emit.
+func parseSource(src string) []class {
+	src = stripComments(src)
+
+	var classes []class
+	depth := 0
+	segmentStart := 0
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '"', '\'':
+			i = skipLiteral(src, i)
+		case ';':
+			if depth == 0 {
+				segmentStart = i + 1
+			}
+		case '{':
+			if depth == 0 {
+				if match := declRe.FindStringSubmatch(src[segmentStart:i]); match != nil {
+					end := matchBrace(src, i)
+					classes = append(classes, parseClass(match[2], match[1] == "enum", src[i+1:end]))
+					i = end
+					segmentStart = end + 1
+					continue
+				}
+			}
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				segmentStart = i + 1
+			}
+		}
+	}
+
+	return classes
+}
+
+func parseClass(name string, enum bool, body string) class {
+	c := class{Name: name, Enum: enum, Constants: map[string]int{}}
+
+	if enum {
+		c.EnumValues = parseEnumValues(body)
+	}
+
+	// Members are read from the body with every nested block cut out, so
+	// that what is left is a list of field declarations and method headers.
+	var members []string
+	memberStart := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '"', '\'':
+			i = skipLiteral(body, i)
+		case ';':
+			members = append(members, body[memberStart:i])
+			memberStart = i + 1
+		case '{':
+			header := body[memberStart:i]
+			end := matchBrace(body, i)
+			if match := methodRe.FindStringSubmatch(strings.TrimSpace(header)); match != nil {
+				if match[1] == "serialize" && !strings.Contains(header, "static") {
+					c.Serialize = body[i+1 : end]
+				} else if match[1] == "deserialize" {
+					c.Deserialize = body[i+1 : end]
+				}
+			}
+			members = append(members, header)
+			i = end
+			memberStart = end + 1
+		}
+	}
+
+	for _, member := range members {
+		member = strings.Join(strings.Fields(member), " ")
+
+		if match := constantRe.FindStringSubmatch(member); match != nil {
+			value, err := strconv.Atoi(match[2])
+			if err == nil {
+				c.Constants[match[1]] = value
+			}
+			continue
+		}
+		if strings.Contains(member, "static ") {
+			continue
+		}
+
+		declaration := member
+		if eq := strings.Index(declaration, "="); eq >= 0 {
+			declaration = declaration[:eq]
+		}
+		if strings.Contains(declaration, "(") {
+			continue
+		}
+
+		match := fieldRe.FindStringSubmatch(strings.TrimSpace(member))
+		if match == nil {
+			continue
+		}
+		c.Fields = append(c.Fields, javaField{
+			Name:     match[3],
+			Type:     match[2],
+			Nullable: strings.Contains(match[1], "Nullable"),
+		})
+	}
+
+	return c
+}
+
+// parseEnumValues reads the constants before the first top-level ';' of an
+// enum body, along with their explicit value when the constructor takes one.
+func parseEnumValues(body string) []enumValue {
+	var values []enumValue
+
+	depth := 0
+	itemStart := 0
+	for i := 0; i <= len(body); i++ {
+		if i < len(body) {
+			switch body[i] {
+			case '"', '\'':
+				i = skipLiteral(body, i)
+				continue
+			case '(', '{':
+				depth++
+				continue
+			case ')', '}':
+				depth--
+				continue
+			case ',', ';':
+				if depth != 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+
+		if match := enumItemRe.FindStringSubmatch(strings.TrimSpace(body[itemStart:min(i, len(body))])); match != nil {
+			value := enumValue{Name: match[1]}
+			if match[2] != "" {
+				n, _ := strconv.Atoi(match[2])
+				value.Value = &n
+			}
+			values = append(values, value)
+		}
+		if i == len(body) || body[i] == ';' {
+			break
+		}
+		itemStart = i + 1
+	}
+
+	return values
+}
+
+// stripComments blanks out comments while keeping string literals intact.
+func stripComments(src string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '"' || src[i] == '\'':
+			end := skipLiteral(src, i)
+			b.WriteString(src[i:min(end+1, len(src))])
+			i = end
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return b.String()
+}
+
+// skipLiteral returns the index of the quote closing the literal opened at i.
+func skipLiteral(src string, i int) int {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		if src[i] == '\\' {
+			i++
+		} else if src[i] == quote {
+			return i
+		}
+	}
+	return len(src)
+}
+
+// matchBrace returns the index of the brace closing the one at open.
+func matchBrace(src string, open int) int {
+	depth := 0
+	for i := open; i < len(src); i++ {
+		switch src[i] {
+		case '"', '\'':
+			i = skipLiteral(src, i)
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(src)
+}
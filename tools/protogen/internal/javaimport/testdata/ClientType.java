@@ -0,0 +1,21 @@
+package com.hypixel.hytale.protocol.packets.connection;
+
+public enum ClientType {
+   Game(0),
+   Editor(1);
+
+   public static final ClientType[] VALUES = values();
+   private final int value;
+
+   private ClientType(int value) {
+      this.value = value;
+   }
+
+   public int getValue() {
+      return this.value;
+   }
+
+   public static ClientType fromValue(int value) {
+      return VALUES[value];
+   }
+}
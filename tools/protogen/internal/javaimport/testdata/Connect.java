@@ -0,0 +1,168 @@
+package com.hypixel.hytale.protocol.packets.connection;
+
+import com.hypixel.hytale.protocol.HostAddress;
+import com.hypixel.hytale.protocol.Packet;
+import com.hypixel.hytale.protocol.io.PacketIO;
+import com.hypixel.hytale.protocol.io.ProtocolException;
+import com.hypixel.hytale.protocol.io.VarInt;
+import io.netty.buffer.ByteBuf;
+import java.util.UUID;
+import javax.annotation.Nonnull;
+import javax.annotation.Nullable;
+
+public class Connect implements Packet {
+   public static final int PACKET_ID = 0;
+   public static final boolean IS_COMPRESSED = false;
+   public static final int NULLABLE_BIT_FIELD_SIZE = 1;
+   public static final int FIXED_BLOCK_SIZE = 82;
+   public static final int VARIABLE_FIELD_COUNT = 5;
+   public static final int VARIABLE_BLOCK_START = 102;
+   public static final int MAX_USERNAME_LENGTH = 16;
+   @Nonnull
+   public String protocolHash = "";
+   @Nonnull
+   public ClientType clientType = ClientType.Game;
+   @Nullable
+   public String language;
+   @Nullable
+   public String identityToken;
+   @Nonnull
+   public UUID uuid = new UUID(0L, 0L);
+   @Nonnull
+   public String username = "";
+   @Nullable
+   public byte[] referralData;
+   @Nullable
+   public HostAddress referralSource;
+
+   public Connect() {
+   }
+
+   @Override
+   public int getId() {
+      return 0;
+   }
+
+   @Nonnull
+   public static Connect deserialize(@Nonnull ByteBuf buf, int offset) {
+      Connect obj = new Connect();
+      byte nullBits = buf.getByte(offset);
+      obj.protocolHash = PacketIO.readFixedAsciiString(buf, offset + 1, 64);
+      obj.clientType = ClientType.fromValue(buf.getByte(offset + 65));
+      obj.uuid = PacketIO.readUUID(buf, offset + 66);
+      if ((nullBits & 1) != 0) {
+         int varPos0 = offset + 102 + buf.getIntLE(offset + 82);
+         int languageLen = VarInt.peek(buf, varPos0);
+         if (languageLen < 0) {
+            throw ProtocolException.negativeLength("Language", languageLen);
+         }
+
+         if (languageLen > 128) {
+            throw ProtocolException.stringTooLong("Language", languageLen, 128);
+         }
+
+         obj.language = PacketIO.readVarString(buf, varPos0, PacketIO.ASCII);
+      }
+
+      if ((nullBits & 2) != 0) {
+         int varPos1 = offset + 102 + buf.getIntLE(offset + 86);
+         int identityTokenLen = VarInt.peek(buf, varPos1);
+         if (identityTokenLen > 8192) {
+            throw ProtocolException.stringTooLong("IdentityToken", identityTokenLen, 8192);
+         }
+
+         obj.identityToken = PacketIO.readVarString(buf, varPos1, PacketIO.UTF8);
+      }
+
+      int varPos2 = offset + 102 + buf.getIntLE(offset + 90);
+      int usernameLen = VarInt.peek(buf, varPos2);
+      if (usernameLen > MAX_USERNAME_LENGTH) {
+         throw ProtocolException.stringTooLong("Username", usernameLen, MAX_USERNAME_LENGTH);
+      }
+
+      obj.username = PacketIO.readVarString(buf, varPos2, PacketIO.ASCII);
+      if ((nullBits & 4) != 0) {
+         int varPos3 = offset + 102 + buf.getIntLE(offset + 94);
+         int referralDataCount = VarInt.peek(buf, varPos3);
+         if (referralDataCount > 4096) {
+            throw ProtocolException.arrayTooLong("ReferralData", referralDataCount, 4096);
+         }
+
+         obj.referralData = PacketIO.readBytes(buf, varPos3 + VarInt.length(buf, varPos3), referralDataCount);
+      }
+
+      if ((nullBits & 8) != 0) {
+         int varPos4 = offset + 102 + buf.getIntLE(offset + 98);
+         obj.referralSource = HostAddress.deserialize(buf, varPos4);
+      }
+
+      return obj;
+   }
+
+   @Override
+   public void serialize(@Nonnull ByteBuf buf) {
+      int startPos = buf.writerIndex();
+      byte nullBits = 0;
+      if (this.language != null) {
+         nullBits = (byte)(nullBits | 1);
+      }
+
+      if (this.identityToken != null) {
+         nullBits = (byte)(nullBits | 2);
+      }
+
+      if (this.referralData != null) {
+         nullBits = (byte)(nullBits | 4);
+      }
+
+      if (this.referralSource != null) {
+         nullBits = (byte)(nullBits | 8);
+      }
+
+      buf.writeByte(nullBits);
+      PacketIO.writeFixedAsciiString(buf, this.protocolHash, 64);
+      buf.writeByte(this.clientType.getValue());
+      PacketIO.writeUUID(buf, this.uuid);
+      int languageOffsetSlot = buf.writerIndex();
+      buf.writeIntLE(0);
+      int identityTokenOffsetSlot = buf.writerIndex();
+      buf.writeIntLE(0);
+      int usernameOffsetSlot = buf.writerIndex();
+      buf.writeIntLE(0);
+      int referralDataOffsetSlot = buf.writerIndex();
+      buf.writeIntLE(0);
+      int referralSourceOffsetSlot = buf.writerIndex();
+      buf.writeIntLE(0);
+      int varBlockStart = buf.writerIndex();
+      if (this.language != null) {
+         buf.setIntLE(languageOffsetSlot, buf.writerIndex() - varBlockStart);
+         PacketIO.writeVarString(buf, this.language, 128);
+      } else {
+         buf.setIntLE(languageOffsetSlot, -1);
+      }
+
+      if (this.identityToken != null) {
+         buf.setIntLE(identityTokenOffsetSlot, buf.writerIndex() - varBlockStart);
+         PacketIO.writeVarString(buf, this.identityToken, 8192);
+      } else {
+         buf.setIntLE(identityTokenOffsetSlot, -1);
+      }
+
+      buf.setIntLE(usernameOffsetSlot, buf.writerIndex() - varBlockStart);
+      PacketIO.writeVarString(buf, this.username, MAX_USERNAME_LENGTH);
+      if (this.referralData != null) {
+         buf.setIntLE(referralDataOffsetSlot, buf.writerIndex() - varBlockStart);
+         VarInt.write(buf, this.referralData.length);
+         buf.writeBytes(this.referralData);
+      } else {
+         buf.setIntLE(referralDataOffsetSlot, -1);
+      }
+
+      if (this.referralSource != null) {
+         buf.setIntLE(referralSourceOffsetSlot, buf.writerIndex() - varBlockStart);
+         this.referralSource.serialize(buf);
+      } else {
+         buf.setIntLE(referralSourceOffsetSlot, -1);
+      }
+   }
+}
@@ -0,0 +1,25 @@
+package com.hypixel.hytale.protocol;
+
+import com.hypixel.hytale.protocol.io.PacketIO;
+import io.netty.buffer.ByteBuf;
+import javax.annotation.Nonnull;
+
+public class HostAddress {
+   public short port;
+   @Nonnull
+   public String host = "";
+
+   /* read back in the same order it is written */
+   @Nonnull
+   public static HostAddress deserialize(@Nonnull ByteBuf buf, int offset) {
+      HostAddress obj = new HostAddress();
+      obj.port = (short)buf.getUnsignedShortLE(offset);
+      obj.host = PacketIO.readVarString(buf, offset + 2, PacketIO.UTF8);
+      return obj;
+   }
+
+   public void serialize(@Nonnull ByteBuf buf) {
+      buf.writeShortLE(this.port);
+      PacketIO.writeVarString(buf, this.host, 256);
+   }
+}
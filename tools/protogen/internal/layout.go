@@ -0,0 +1,173 @@
+package protogen
+
+import "fmt"
+
+// PacketLayout describes where each field of a packet lives on the wire:
+// a nullBits byte, a block of fixed position fields, a table of int32
+// offsets (one per variable field) and finally the variable block.
+type PacketLayout struct {
+	Fixed              []FieldLayout
+	Variable           []FieldLayout
+	VariableBlockStart int
+}
+
+type FieldLayout struct {
+	Field *FieldNode
+	// Offset is the absolute position of a fixed field, or the position of
+	// the offset table slot for a variable field.
+	Offset int
+	// NullBit is the mask tested against nullBits, or 0 if the field is
+	// always present.
+	NullBit byte
+}
+
+func ComputeLayout(file *FileNode, packet *PacketNode) (*PacketLayout, error) {
+	layout := &PacketLayout{}
+	offset := 1
+
+	for i := range packet.Fields {
+		field := &packet.Fields[i]
+		if !field.Fixed {
+			continue
+		}
+
+		size, ok := FixedSize(file, field.Type)
+		if !ok {
+			return nil, fmt.Errorf("field %s of type %s cannot be in the fixed block", field.Name, field.Type.Name)
+		}
+
+		layout.Fixed = append(layout.Fixed, FieldLayout{Field: field, Offset: offset})
+		offset += size
+	}
+
+	nullBitIndex := 0
+	for i := range packet.Fields {
+		field := &packet.Fields[i]
+		if field.Fixed {
+			continue
+		}
+
+		var nullBit byte
+		if field.Optional {
+			if nullBitIndex >= 8 {
+				return nil, fmt.Errorf("packet %s has more than 8 optional fields", packet.Name)
+			}
+			nullBit = 1 << nullBitIndex
+			nullBitIndex++
+		}
+
+		layout.Variable = append(layout.Variable, FieldLayout{Field: field, Offset: offset, NullBit: nullBit})
+		offset += 4
+	}
+
+	layout.VariableBlockStart = offset
+
+	return layout, nil
+}
+
+// FixedSize returns the encoded size of a type when it does not depend on
+// the value, which is what allows it to sit in a fixed block.
+func FixedSize(file *FileNode, fieldType FieldTypeNode) (int, bool) {
+	switch fieldType.Name {
+	case "bool", "int8", "uint8", "byte":
+		return 1, true
+	case "int16", "uint16":
+		return 2, true
+	case "int32", "uint32", "float32":
+		return 4, true
+	case "int64", "uint64", "float64":
+		return 8, true
+	case "uuid":
+		return 16, true
+	case "ascii", "utf8", "string":
+		if fieldType.MinSize == nil && fieldType.MaxSize != nil {
+			return *fieldType.MaxSize, true
+		}
+		return 0, false
+	}
+
+	if vector, ok := vectorTypes[fieldType.Name]; ok {
+		return vector.Size, true
+	}
+
+	switch node := file.FindAny(fieldType.Name).(type) {
+	case *EnumNode:
+		return 1, true
+	case *TypeNode:
+		size := 0
+		for _, field := range node.Fields {
+			fieldSize, ok := FixedSize(file, field.Type)
+			if !ok {
+				return 0, false
+			}
+			size += fieldSize
+		}
+		return size, true
+	}
+
+	return 0, false
+}
+
+// MaxEncodedSize returns the largest number of bytes a value of fieldType
+// can take on the wire, failing for types without an upper bound.
+func MaxEncodedSize(file *FileNode, fieldType FieldTypeNode) (int, error) {
+	if size, ok := FixedSize(file, fieldType); ok {
+		return size, nil
+	}
+
+	switch fieldType.Name {
+	case "varint", "svarint":
+		return 5, nil
+	case "varlong":
+		return 10, nil
+	case "ascii", "utf8", "string", "array.byte":
+		if fieldType.MaxSize == nil {
+			return 0, fmt.Errorf("%s has no max size", fieldType.Name)
+		}
+		return varIntSize(*fieldType.MaxSize) + *fieldType.MaxSize, nil
+	}
+
+	if node, ok := file.FindAny(fieldType.Name).(*TypeNode); ok {
+		size := 0
+		for _, field := range node.Fields {
+			fieldSize, err := MaxEncodedSize(file, field.Type)
+			if err != nil {
+				return 0, fmt.Errorf("%s.%s: %w", node.Name, field.Name, err)
+			}
+			size += fieldSize
+		}
+		return size, nil
+	}
+
+	return 0, fmt.Errorf("unsupported type %s", fieldType.Name)
+}
+
+// MaxPacketSize returns the worst-case payload size of packet: its fixed
+// frame followed by every variable field at its largest.
+func MaxPacketSize(file *FileNode, packet *PacketNode) (int, error) {
+	layout, err := ComputeLayout(file, packet)
+	if err != nil {
+		return 0, err
+	}
+
+	size := layout.VariableBlockStart
+	for _, fl := range layout.Variable {
+		fieldSize, err := MaxEncodedSize(file, fl.Field.Type)
+		if err != nil {
+			return 0, fmt.Errorf("packet %s field %s: %w", packet.Name, fl.Field.Name, err)
+		}
+		size += fieldSize
+	}
+
+	return size, nil
+}
+
+// varIntSize is the number of bytes the varint length prefix of n takes.
+func varIntSize(n int) int {
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size
+}
@@ -35,70 +35,85 @@ func (l *Lexer) readChar() {
 	}
 }
 
+// NextToken returns the next token, positioned at its first character.
 func (l *Lexer) NextToken() Token {
 	l.skipWhitespace()
 
+	line, col := l.Line, l.Col
+
 	switch l.ch {
 	case '{':
 		l.readChar()
-		return Token{Type: TokenLBrace, Value: "{", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenLBrace, Value: "{", Line: line, Col: col}
 	case '}':
 		l.readChar()
-		return Token{Type: TokenRBrace, Value: "}", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenRBrace, Value: "}", Line: line, Col: col}
 	case '(':
 		l.readChar()
-		return Token{Type: TokenLParen, Value: "(", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenLParen, Value: "(", Line: line, Col: col}
 	case ')':
 		l.readChar()
-		return Token{Type: TokenRParen, Value: ")", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenRParen, Value: ")", Line: line, Col: col}
 	case '[':
 		l.readChar()
-		return Token{Type: TokenLBracket, Value: "[", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenLBracket, Value: "[", Line: line, Col: col}
 	case ']':
 		l.readChar()
-		return Token{Type: TokenRBracket, Value: "]", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenRBracket, Value: "]", Line: line, Col: col}
 	case '=':
 		l.readChar()
-		return Token{Type: TokenEqual, Value: "=", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenEqual, Value: "=", Line: line, Col: col}
 	case ':':
 		l.readChar()
-		return Token{Type: TokenColon, Value: ":", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenColon, Value: ":", Line: line, Col: col}
 	case ',':
 		l.readChar()
-		return Token{Type: TokenComma, Value: ",", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenComma, Value: ",", Line: line, Col: col}
 	case '@':
 		l.readChar()
-		return Token{Type: TokenAt, Value: "@", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenAt, Value: "@", Line: line, Col: col}
 	case '?':
 		l.readChar()
-		return Token{Type: TokenOptional, Value: "?", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenOptional, Value: "?", Line: line, Col: col}
 	case '"', '\'':
-		return l.readString()
+		str := l.readString()
+		return Token{Type: TokenString, Value: str, Line: line, Col: col}
 	case 0:
-		return Token{Type: TokenEOF, Value: "", Line: l.Line, Col: l.Col}
+		return Token{Type: TokenEOF, Value: "", Line: line, Col: col}
 	default:
 		if l.ch == '/' {
 			path := l.readPath()
-			return Token{Type: TokenPath, Value: path, Line: l.Line, Col: l.Col}
+			return Token{Type: TokenPath, Value: path, Line: line, Col: col}
 		} else if isLetter(l.ch) {
 			ident := l.readIdentifier()
 			if isKeyword(ident) {
-				return Token{Type: TokenKeyword, Value: ident, Line: l.Line, Col: l.Col}
+				return Token{Type: TokenKeyword, Value: ident, Line: line, Col: col}
 			}
-			return Token{Type: TokenIdent, Value: ident, Line: l.Line, Col: l.Col}
+			return Token{Type: TokenIdent, Value: ident, Line: line, Col: col}
 		} else if unicode.IsDigit(l.ch) {
 			num := l.readNumber()
-			return Token{Type: TokenNumber, Value: num, Line: l.Line, Col: l.Col}
+			return Token{Type: TokenNumber, Value: num, Line: line, Col: col}
 		}
 		illegal := l.ch
 		l.readChar()
-		return Token{Type: TokenIllegal, Value: string(illegal)}
+		return Token{Type: TokenIllegal, Value: string(illegal), Line: line, Col: col}
 	}
 }
 
+// skipWhitespace skips whitespace and comments, which run from # to the
+// end of the line.
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		l.readChar()
+	for {
+		switch l.ch {
+		case ' ', '\t', '\n', '\r':
+			l.readChar()
+		case '#':
+			for l.ch != '\n' && l.ch != 0 {
+				l.readChar()
+			}
+		default:
+			return
+		}
 	}
 }
 
@@ -118,7 +133,7 @@ func (l *Lexer) readNumber() string {
 	return l.input[pos:l.position]
 }
 
-func (l *Lexer) readString() Token {
+func (l *Lexer) readString() string {
 	quote := l.ch
 	l.readChar() // skip opening quote
 	pos := l.position
@@ -127,7 +142,7 @@ func (l *Lexer) readString() Token {
 	}
 	str := l.input[pos:l.position]
 	l.readChar() // skip closing quote
-	return Token{Type: TokenString, Value: str, Line: l.Line, Col: l.Col}
+	return str
 }
 
 func (l *Lexer) readPath() string {
@@ -144,6 +159,9 @@ func isLetter(ch rune) bool {
 
 func isKeyword(ident string) bool {
 	// Only treat truly reserved words as keywords, e.g. 'enum' or 'packet'.
+	// The 'deprecated' and 'unreliable' modifiers lex as identifiers and
+	// are recognised by the parser where one can appear, so they stay
+	// usable as field names.
 	reserved := []string{"enum", "packet", "type"}
 	for _, k := range reserved {
 		if ident == k {
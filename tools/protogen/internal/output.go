@@ -0,0 +1,42 @@
+package protogen
+
+import (
+	"fmt"
+	"go/format"
+	"os"
+
+	"github.com/incu6us/goimports-reviser/v3/reviser"
+)
+
+// WriteGoFile generates the code for ast as package packageName and writes
+// it, formatted and with unused imports removed, to outfile.
+func WriteGoFile(outfile string, packageName string, ast *FileNode, options GenerateOptions) error {
+	finalCode := fmt.Sprintf("// Code generated by protogen. DO NOT EDIT.\n\npackage %s\n\n", packageName)
+	// imports the generated code may need, unused ones are removed below
+	finalCode += "import (\n\t\"encoding/binary\"\n\t\"fmt\"\n\t\"sync\"\n\n\t\"github.com/google/uuid\"\n)\n\n"
+	finalCode += "type Packet interface {\n\tID() uint32\n\t// MaxSize is the largest payload the packet can have.\n\tMaxSize() int\n}\n\n"
+
+	code, err := GenerateGoCode(ast, options)
+	if err != nil {
+		return fmt.Errorf("error generating code: %w", err)
+	}
+	finalCode += code + "\n\n"
+
+	formattedCode, err := format.Source([]byte(finalCode))
+	if err != nil {
+		return fmt.Errorf("error formatting generated code: %w", err)
+	}
+
+	err = os.WriteFile(outfile, formattedCode, 0644)
+	if err != nil {
+		return err
+	}
+
+	sourceFile := reviser.NewSourceFile(packageName, outfile)
+	fixedCode, _, _, err := sourceFile.Fix(reviser.WithRemovingUnusedImports)
+	if err != nil {
+		return fmt.Errorf("error fixing imports: %w", err)
+	}
+
+	return os.WriteFile(outfile, fixedCode, 0644)
+}
@@ -3,24 +3,43 @@ package protogen
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // Parser holds the state for parsing
 type Parser struct {
 	lexer  *Lexer
 	curTok Token
+	// ahead holds tokens read by peek and not consumed yet
+	ahead  []Token
+	lines  []string
+	errors ParserErrors
 }
 
 func NewParser(input string) *Parser {
 	lex := NewLexer(input)
-	return &Parser{lexer: lex, curTok: lex.NextToken()}
+	return &Parser{lexer: lex, curTok: lex.NextToken(), lines: strings.Split(input, "\n")}
 }
 
 func (p *Parser) next() Token {
+	if len(p.ahead) > 0 {
+		p.curTok = p.ahead[0]
+		p.ahead = p.ahead[1:]
+		return p.curTok
+	}
 	p.curTok = p.lexer.NextToken()
 	return p.curTok
 }
 
+// peek returns the token n places after the current one without
+// consuming anything.
+func (p *Parser) peek(n int) Token {
+	for len(p.ahead) < n {
+		p.ahead = append(p.ahead, p.lexer.NextToken())
+	}
+	return p.ahead[n-1]
+}
+
 func (p *Parser) current() Token {
 	return p.curTok
 }
@@ -30,36 +49,106 @@ func (p *Parser) expect(typ TokenType) bool {
 }
 
 func (p *Parser) getError(message string) error {
-	return &ParserError{
-		Message: message,
-		Line:    p.curTok.Line,
-		Col:     p.curTok.Col - len(p.curTok.Value),
-	}
+	return p.getErrorf("%s", message)
 }
 
 func (p *Parser) getErrorf(format string, args ...interface{}) error {
-	return &ParserError{
+	err := &ParserError{
 		Message: fmt.Sprintf(format, args...),
 		Line:    p.curTok.Line,
-		Col:     p.curTok.Col - len(p.curTok.Value),
+		Col:     p.curTok.Col,
+	}
+	if p.curTok.Line > 0 && p.curTok.Line <= len(p.lines) {
+		err.SourceLine = strings.TrimRight(p.lines[p.curTok.Line-1], "\r")
+	}
+	return err
+}
+
+// recordError keeps err so parsing can carry on and report every problem
+// in a file at once.
+func (p *Parser) recordError(err error) {
+	var parseErr *ParserError
+	if errors.As(err, &parseErr) {
+		p.errors = append(p.errors, parseErr)
+	} else {
+		p.errors = append(p.errors, &ParserError{Message: err.Error(), Line: p.curTok.Line, Col: p.curTok.Col})
 	}
 }
 
 type ParserError struct {
-	Message string
-	Line    int
-	Col     int
+	Message    string
+	Line       int
+	Col        int
+	SourceLine string
 }
 
 func (e *ParserError) Error() string {
 	return e.Message
 }
 
+// ParserErrors is returned by Parse when one or more declarations failed
+// to parse.
+type ParserErrors []*ParserError
+
+func (e ParserErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = fmt.Sprintf("%d:%d: %s", err.Line, err.Col, err.Message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e ParserErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// FormatParseError formats parse errors compiler-style, quoting the
+// offending line with a caret under the column.
 func FormatParseError(err error, fileName string) string {
+	var parseErrs ParserErrors
+	if errors.As(err, &parseErrs) {
+		buf := &strings.Builder{}
+		for _, parseErr := range parseErrs {
+			buf.WriteString(formatParserError(parseErr, fileName))
+		}
+		fmt.Fprintf(buf, "%d error(s) in %s\n", len(parseErrs), fileName)
+		return buf.String()
+	}
+
 	var parseErr *ParserError
 	if errors.As(err, &parseErr) {
-		return fmt.Sprintf("%s:%d:%d: %s\n", fileName, parseErr.Line, parseErr.Col, parseErr.Message)
+		return formatParserError(parseErr, fileName)
 	}
 
 	return err.Error()
 }
+
+func formatParserError(err *ParserError, fileName string) string {
+	str := fmt.Sprintf("%s:%d:%d: error: %s\n", fileName, err.Line, err.Col, err.Message)
+	if err.SourceLine == "" {
+		return str
+	}
+
+	gutter := fmt.Sprintf("%5d | ", err.Line)
+	str += gutter + err.SourceLine + "\n"
+
+	// keep tabs so the caret lines up with the quoted source
+	padding := []rune{}
+	for i, ch := range err.SourceLine {
+		if i >= err.Col-1 {
+			break
+		}
+		if ch == '\t' {
+			padding = append(padding, '\t')
+		} else {
+			padding = append(padding, ' ')
+		}
+	}
+	str += strings.Repeat(" ", len(gutter)-2) + "| " + string(padding) + "^\n"
+
+	return str
+}
@@ -1,6 +1,8 @@
 package protogen
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/gkampitakis/go-snaps/snaps"
@@ -38,3 +40,172 @@ func TestBasicType(t *testing.T) {
 
 	snaps.MatchSnapshot(t, ast)
 }
+
+func TestErrorRecovery(t *testing.T) {
+	parser := NewParser(`packet Connect {
+	protocolHash ascii[64]
+}
+
+packet 1 LoginRequest {
+	username ascii[
+	@language? ascii[0:128]
+	@count 12
+	@valid? varint
+}
+
+type HostAddress {
+	port uint16
+	$ hostname
+}
+`)
+	_, err := parser.Parse()
+
+	var errs ParserErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ParserErrors, got %v", err)
+	}
+	if len(errs) != 4 {
+		t.Errorf("expected 4 errors, got %d", len(errs))
+	}
+
+	snaps.MatchSnapshot(t, FormatParseError(err, "test.schema"))
+}
+
+func TestAnnotations(t *testing.T) {
+	ast, err := NewParser(`
+	@since(2) deprecated
+	packet 4 Chat {
+		@message utf8[0:256]
+		@since(3) @channel? ascii[0:16]
+		@until(5) deprecated color Color
+		@since ascii[4]
+	}
+	`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+
+	// a field named since is still a field
+	if ast.FindPacket("Chat").Fields[3].Name != "since" {
+		t.Fatalf("unexpected fields: %+v", ast.FindPacket("Chat").Fields)
+	}
+
+	// the formatter writes the annotations back
+	snaps.MatchSnapshot(t, FormatSchema(ast))
+
+	_, err = NewParser(`
+	packet 1 Bad {
+		@until(3) @since(5) @name ascii[0:4]
+	}
+	`).Parse()
+	if err == nil || !strings.Contains(err.Error(), "@until(3) must be after @since(5)") {
+		t.Fatalf("expected a version range error, got %v", err)
+	}
+}
+
+func TestUnreliable(t *testing.T) {
+	ast, err := NewParser(`
+	unreliable packet 7 Move {
+		position vec3d
+	}
+	@since(2) unreliable
+	packet 8 Look {
+		rotation quatf
+	}
+	packet 9 Chat {
+		@message utf8[0:256]
+	}
+	@until(4) deprecated unreliable
+	packet 10 OldMove {
+		position vec3f
+	}
+	`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+	if !ast.FindPacket("Move").Unreliable || !ast.FindPacket("Look").Unreliable || ast.FindPacket("Chat").Unreliable {
+		t.Fatal("unreliable marker not parsed")
+	}
+	if old := ast.FindPacket("OldMove"); !old.Unreliable || !old.Deprecated {
+		t.Fatalf("OldMove = %+v", old)
+	}
+	if since := ast.FindPacket("Look").Since; since == nil || *since != 2 {
+		t.Fatalf("Look since = %v", since)
+	}
+
+	formatted := FormatSchema(ast)
+	if !strings.Contains(formatted, "unreliable\npacket 7 Move") || !strings.Contains(formatted, "@since(2) unreliable\npacket 8 Look") {
+		t.Fatalf("formatted:\n%s", formatted)
+	}
+
+	_, err = NewParser(`
+	unreliable enum Bad {
+		A
+	}
+	`).Parse()
+	if err == nil || !strings.Contains(err.Error(), "expected 'packet' after annotations") {
+		t.Fatalf("unreliable enum: %v", err)
+	}
+}
+
+func TestModifierFieldNames(t *testing.T) {
+	ast, err := NewParser(`
+	deprecated
+	packet 1 Item {
+		deprecated bool
+		deprecated? bool
+		@deprecated ascii[0:8]
+		deprecated deprecated bool
+		@until(2) deprecated
+		name ascii[4]
+		deprecated Color
+		unreliable bool
+		@unreliable? ascii[0:8]
+		@tail ascii[0:8]
+	}
+	`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+
+	item := ast.FindPacket("Item")
+	want := []struct {
+		name       string
+		deprecated bool
+	}{
+		{"deprecated", false},
+		{"deprecated", false},
+		{"deprecated", false},
+		{"deprecated", true},
+		{"name", true},
+		{"deprecated", false},
+		{"unreliable", false},
+		{"unreliable", false},
+		{"tail", false},
+	}
+	if !item.Deprecated || item.Unreliable || len(item.Fields) != len(want) {
+		t.Fatalf("unexpected packet: %+v", item)
+	}
+	for i, field := range item.Fields {
+		if field.Name != want[i].name || field.Deprecated != want[i].deprecated {
+			t.Errorf("field %d = %s, deprecated %v", i, field.Name, field.Deprecated)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	ast, err := NewParser(`
+	# not a Hytale packet
+	packet 2 Ping { # trailing
+		@sequence varint
+		# between fields
+		@lastRTTMillis varint
+	}
+	#`).Parse()
+	if err != nil {
+		t.Fatal(FormatParseError(err, "unknown"))
+	}
+	if ping := ast.FindPacket("Ping"); ping == nil || len(ping.Fields) != 2 {
+		t.Fatalf("Ping = %+v", ping)
+	}
+}
@@ -0,0 +1,144 @@
+package protogen
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+)
+
+// versionBreakpoints returns, in order, the versions at which a field of
+// packet appears or disappears.
+func versionBreakpoints(packet *PacketNode) []int {
+	var points []int
+	for _, field := range packet.Fields {
+		if field.Since != nil {
+			points = append(points, *field.Since)
+		}
+		if field.Until != nil {
+			points = append(points, *field.Until)
+		}
+	}
+	slices.Sort(points)
+	return slices.Compact(points)
+}
+
+// AtVersion returns packet with only the fields present in version.
+func (p *PacketNode) AtVersion(version int) *PacketNode {
+	projected := *p
+	projected.Fields = nil
+	for _, field := range p.Fields {
+		if field.Includes(version) {
+			projected.Fields = append(projected.Fields, field)
+		}
+	}
+	return &projected
+}
+
+// Newest returns packet as laid out by the newest version it describes.
+func (p *PacketNode) Newest() *PacketNode {
+	ranges := versionRanges(p)
+	if ranges == nil {
+		return p
+	}
+	return p.AtVersion(ranges[len(ranges)-1])
+}
+
+// versionRanges splits the versions of packet into spans sharing a layout,
+// each given by its first version. The first span starts with the packet.
+func versionRanges(packet *PacketNode) []int {
+	first := 0
+	if packet.Since != nil {
+		first = *packet.Since
+	}
+
+	ranges := []int{first}
+	for _, point := range versionBreakpoints(packet) {
+		if point > first && (packet.Until == nil || point < *packet.Until) {
+			ranges = append(ranges, point)
+		}
+	}
+	if len(ranges) == 1 {
+		return nil
+	}
+	return ranges
+}
+
+// versionComment documents which versions carry an annotated item, or
+// returns "" when it is in every version.
+func versionComment(versions Versions) string {
+	switch {
+	case versions.Since != nil && versions.Until != nil:
+		return "Present from version " + strconv.Itoa(*versions.Since) + ", removed in " + strconv.Itoa(*versions.Until) + "."
+	case versions.Since != nil:
+		return "Present from version " + strconv.Itoa(*versions.Since) + "."
+	case versions.Until != nil:
+		return "Removed in version " + strconv.Itoa(*versions.Until) + "."
+	}
+	return ""
+}
+
+// generateVersionedDecoders returns a decoder per layout of packet and
+// Decode<Packet>Version choosing between them, or "" when every version
+// shares one layout.
+func generateVersionedDecoders(file *FileNode, packet *PacketNode) (string, error) {
+	ranges := versionRanges(packet)
+	if ranges == nil {
+		return "", nil
+	}
+
+	code := ""
+	for i, since := range ranges {
+		projected := packet.AtVersion(since)
+		parsingBody, sizeOfFixedFrame, err := writeDecodeBody(file, projected, false)
+		if err != nil {
+			return "", err
+		}
+
+		data := newDecodeData(projected, parsingBody, sizeOfFixedFrame)
+		data.Suffix = "V" + strconv.Itoa(since)
+
+		span := "from version " + strconv.Itoa(since)
+		if i < len(ranges)-1 {
+			span = "for versions " + strconv.Itoa(since) + " to " + strconv.Itoa(ranges[i+1]-1)
+		}
+		code += "// Decode" + packet.Name + data.Suffix + " decodes a " + packet.Name + " laid out as " + span + ".\n"
+
+		decodeBuf := bytes.NewBufferString("")
+		if err := decodeTemplate.Execute(decodeBuf, data); err != nil {
+			return "", err
+		}
+		code += decodeBuf.String() + "\n\n"
+	}
+
+	code += "// Decode" + packet.Name + "Version decodes a " + packet.Name + " sent by a peer speaking version.\n"
+	code += "func Decode" + packet.Name + "Version(version int, payload []byte) (Packet, error) {\n"
+	code += "\tswitch {\n"
+	for i := len(ranges) - 1; i > 0; i-- {
+		code += "\tcase version >= " + strconv.Itoa(ranges[i]) + ":\n"
+		code += "\t\treturn Decode" + packet.Name + "V" + strconv.Itoa(ranges[i]) + "(payload)\n"
+	}
+	code += "\tdefault:\n"
+	code += "\t\treturn Decode" + packet.Name + "V" + strconv.Itoa(ranges[0]) + "(payload)\n"
+	code += "\t}\n"
+	code += "}\n\n"
+
+	return code, nil
+}
+
+// maxVersionedPacketSize is MaxPacketSize over every layout of packet.
+func maxVersionedPacketSize(file *FileNode, packet *PacketNode) (int, error) {
+	ranges := versionRanges(packet)
+	if ranges == nil {
+		return MaxPacketSize(file, packet)
+	}
+
+	largest := 0
+	for _, since := range ranges {
+		size, err := MaxPacketSize(file, packet.AtVersion(since))
+		if err != nil {
+			return 0, err
+		}
+		largest = max(largest, size)
+	}
+	return largest, nil
+}
@@ -2,31 +2,40 @@ package main
 
 import (
 	"fmt"
-	"go/format"
 	"hygoal/tools/protogen/internal"
 	"os"
 	"path"
 	"strings"
 
 	"github.com/alecthomas/kong"
-	"github.com/incu6us/goimports-reviser/v3/reviser"
 )
 
 var CLI struct {
+	Generate   GenerateCmd   `cmd:"" default:"withargs" help:"Generate Go code from .schema files."`
+	Inspect    InspectCmd    `cmd:"" help:"Decode a hex dump of a packet payload using the schemas at runtime."`
+	ImportJava ImportJavaCmd `cmd:"" name:"import-java" help:"Draft .schema declarations from decompiled Java packet classes."`
+}
+
+type GenerateCmd struct {
 	Input  string `help:"Input directory containing .proto files." short:"i" required:"" type:"path"`
 	Output string `help:"Output directory for generated Go files." short:"o" required:"" type:"path"`
+
+	DecodeInto bool `help:"Also generate Decode<Packet>Into functions and pooled packet factories."`
 }
 
 func main() {
 	ctx := kong.Parse(&CLI)
-	_ = ctx
+	ctx.FatalIfErrorf(ctx.Run())
+}
 
-	dir, err := os.ReadDir(CLI.Input)
+func (c *GenerateCmd) Run() error {
+	dir, err := os.ReadDir(c.Input)
 	if err != nil {
 		panic(err)
 	}
 
 	fileAsts := make([]*protogen.FileNode, 0)
+	failed := false
 
 	for _, entry := range dir {
 		if entry.IsDir() {
@@ -34,7 +43,7 @@ func main() {
 			continue
 		}
 		if entry.Type().IsRegular() && len(entry.Name()) > 6 && strings.HasSuffix(entry.Name(), ".schema") {
-			data, err := os.ReadFile(CLI.Input + "/" + entry.Name())
+			data, err := os.ReadFile(c.Input + "/" + entry.Name())
 			if err != nil {
 				panic(err)
 			}
@@ -43,7 +52,9 @@ func main() {
 			ast, err := parser.Parse()
 
 			if err != nil {
-				panic(protogen.FormatParseError(err, entry.Name()))
+				fmt.Fprint(os.Stderr, protogen.FormatParseError(err, entry.Name()))
+				failed = true
+				continue
 			}
 
 			fileAsts = append(fileAsts, ast)
@@ -54,6 +65,10 @@ func main() {
 		}
 	}
 
+	if failed {
+		os.Exit(1)
+	}
+
 	combinedAst := &protogen.FileNode{
 		Expressions: make([]protogen.Node, 0),
 	}
@@ -62,34 +77,15 @@ func main() {
 		combinedAst.Expressions = append(combinedAst.Expressions, ast.Expressions...)
 	}
 
-	finalCode := fmt.Sprintf("// Code generated by protogen. DO NOT EDIT.\n\npackage %s\n\n", path.Base(CLI.Output))
-	finalCode += "type Packet interface {\n\tID() uint32\n}\n\n"
-
-	code, err := protogen.GenerateGoCode(combinedAst)
-	if err != nil {
-		panic(err)
-	}
-	finalCode += code + "\n\n"
-
-	outfile := CLI.Output + "/generated.go"
-
-	err = os.WriteFile(outfile, []byte(finalCode), 0644)
-	if err != nil {
-		panic(err)
-	}
-
-	formattedCode, err := format.Source([]byte(finalCode))
-	if err != nil {
-		panic(err)
-	}
+	outfile := c.Output + "/generated.go"
 
-	err = os.WriteFile(outfile, formattedCode, 0644)
+	err = protogen.WriteGoFile(outfile, path.Base(c.Output), combinedAst, protogen.GenerateOptions{DecodeInto: c.DecodeInto})
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	sourceFile := reviser.NewSourceFile("hygoal", outfile)
-	_, _, _, err = sourceFile.Fix()
+	fmt.Printf("Generated Go code written to %s/generated.go\n", c.Output)
 
-	fmt.Printf("Generated Go code written to %s/generated.go\n", CLI.Output)
+	return nil
 }